@@ -1,14 +1,22 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"os/signal"
+	"path"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/pojntfx/dibs/pkg/utils"
 	"gopkg.in/yaml.v2"
@@ -16,22 +24,61 @@ import (
 
 // Config is a dibs configuration
 type Config struct {
-	Targets []struct {
+	Credentials map[string]credentialConfig `yaml:"credentials"`
+	Targets     []struct {
 		Name string `yaml:"name"`
 		Helm struct {
-			Src  string `yaml:"src"`
-			Dist string `yaml:"dist"`
+			Src          string   `yaml:"src"`
+			Dist         string   `yaml:"dist"`
+			StampVersion bool     `yaml:"stampVersion"`
+			GitRepoRoot  string   `yaml:"gitRepoRoot"`
+			OCIRegistry  string   `yaml:"ociRegistry"`
+			OCIPlainHTTP bool     `yaml:"ociPlainHTTP"`
+			ValuesFiles  []string `yaml:"valuesFiles"`
+			ImageValue   string   `yaml:"imageValue"`
+			InjectImage  bool     `yaml:"injectImage"`
+			Repository   struct {
+				URL       string `yaml:"url"`
+				Branch    string `yaml:"branch"`
+				Dir       string `yaml:"dir"`
+				ChartsURL string `yaml:"chartsURL"`
+				Username  string `yaml:"username"`
+				SSHKey    string `yaml:"sshKey"`
+				GitHub    struct {
+					Owner      string `yaml:"owner"`
+					Repository string `yaml:"repository"`
+				} `yaml:"github"`
+				Author struct {
+					Name  string `yaml:"name"`
+					Email string `yaml:"email"`
+				} `yaml:"author"`
+				CommitMessage string `yaml:"commitMessage"`
+			} `yaml:"repository"`
 		}
 		DockerManifest string `yaml:"dockerManifest"`
-		Platforms      []struct {
+		Release        struct {
+			Name     string   `yaml:"name"`
+			Format   string   `yaml:"format"`
+			Template string   `yaml:"template"`
+			Files    []string `yaml:"files"`
+			Dist     string   `yaml:"dist"`
+			Notes    string   `yaml:"notes"`
+		}
+		Platforms []struct {
 			Identifier string `yaml:"identifier"`
 			Paths      struct {
-				Watch        string `yaml:"watch"`
-				Include      string `yaml:"include"`
-				AssetInImage string `yaml:"assetInImage"`
-				AssetOut     string `yaml:"assetOut"`
-				GitRepoRoot  string `yaml:"gitRepoRoot"`
+				Watch        stringList `yaml:"watch"`
+				Include      string     `yaml:"include"`
+				AssetInImage string     `yaml:"assetInImage"`
+				AssetOut     string     `yaml:"assetOut"`
+				GitRepoRoot  string     `yaml:"gitRepoRoot"`
 			}
+			Watcher  watcherConfig   `yaml:"watcher"`
+			Services []serviceConfig `yaml:"services"`
+			// Probes, Restart and Debug configure the start command
+			Probes   probesConfig  `yaml:"probes"`
+			Restart  restartConfig `yaml:"restart"`
+			Debug    *debugConfig  `yaml:"debug"`
 			Commands struct {
 				GenerateSources  string `yaml:"generateSources"`
 				Build            string `yaml:"build"`
@@ -42,96 +89,1354 @@ type Config struct {
 				Publish          string `yaml:"publish"`
 				Start            string `yaml:"start"`
 			}
-			Docker struct {
-				Build            dockerConfig `yaml:"build"`
-				UnitTests        dockerConfig `yaml:"unitTests"`
-				IntegrationTests dockerConfig `yaml:"integrationTests"`
-				ChartTests       dockerConfig `yaml:"chartTests"`
-				Publish          dockerConfig `yaml:"publish"`
+			Docker struct {
+				Build            dockerConfig `yaml:"build"`
+				UnitTests        dockerConfig `yaml:"unitTests"`
+				IntegrationTests dockerConfig `yaml:"integrationTests"`
+				ChartTests       dockerConfig `yaml:"chartTests"`
+				Publish          dockerConfig `yaml:"publish"`
+				// Dev is the image in which the commands are run with -dev and -docker
+				Dev devDockerConfig `yaml:"dev"`
+			}
+		}
+	}
+}
+
+type credentialConfig struct {
+	Env     string `yaml:"env"`
+	File    string `yaml:"file"`
+	DotEnv  string `yaml:"dotEnv"`
+	Key     string `yaml:"key"`
+	Command string `yaml:"command"`
+}
+
+// Credentials which are not configured in the credentials section are read from these env variables
+var defaultCredentialEnvVariables = map[string]string{
+	"gitUserName":          "DIBS_GIT_USER_NAME",
+	"gitUserEmail":         "DIBS_GIT_USER_EMAIL",
+	"gitCommitMessage":     "DIBS_GIT_COMMIT_MESSAGE",
+	"gitPassword":          "DIBS_GIT_PASSWORD",
+	"sshKeyPassword":       "DIBS_SSH_KEY_PASSWORD",
+	"githubUserName":       "DIBS_GITHUB_USER_NAME",
+	"githubToken":          "DIBS_GITHUB_TOKEN",
+	"githubRepository":     "DIBS_GITHUB_REPOSITORY",
+	"githubRepositoryName": "DIBS_GITHUB_REPOSITORY_NAME",
+	"githubRepositoryURL":  "DIBS_GITHUB_REPOSITORY_URL",
+	"githubPagesURL":       "DIBS_GITHUB_PAGES_URL",
+	"ociUsername":          "DIBS_OCI_USERNAME",
+	"ociPassword":          "DIBS_OCI_PASSWORD",
+	"signingKey":           "DIBS_SIGNING_KEY",
+	"signingGPGKeyID":      "DIBS_SIGNING_GPG_KEY_ID",
+}
+
+func getCredentialSources(configs map[string]credentialConfig) map[string]utils.CredentialSource {
+	sources := map[string]utils.CredentialSource{}
+	for name, envVariable := range defaultCredentialEnvVariables {
+		sources[name] = utils.CredentialSource{Env: envVariable}
+	}
+
+	for name, config := range configs {
+		sources[name] = utils.CredentialSource{
+			Env:     config.Env,
+			File:    config.File,
+			DotEnv:  config.DotEnv,
+			Key:     config.Key,
+			Command: config.Command,
+		}
+	}
+
+	return sources
+}
+
+// stringList is a list of strings which may also be set to a single string
+type stringList []string
+
+func (s *stringList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var single string
+	if err := unmarshal(&single); err == nil {
+		*s = stringList{single}
+
+		return nil
+	}
+
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+
+	*s = list
+
+	return nil
+}
+
+type watcherConfig struct {
+	Backend     string   `yaml:"backend"`
+	Debounce    string   `yaml:"debounce"`
+	Include     []string `yaml:"include"`
+	Exclude     []string `yaml:"exclude"`
+	IgnoreFiles []string `yaml:"ignoreFiles"`
+	Stages      []struct {
+		Pattern string `yaml:"pattern"`
+		Stage   string `yaml:"stage"`
+	} `yaml:"stages"`
+}
+
+type probeConfig struct {
+	TCP              string `yaml:"tcp"`
+	HTTP             string `yaml:"http"`
+	Log              string `yaml:"log"`
+	Exec             string `yaml:"exec"`
+	Interval         string `yaml:"interval"`
+	Timeout          string `yaml:"timeout"`
+	FailureThreshold int    `yaml:"failureThreshold"`
+}
+
+type probesConfig struct {
+	Readiness *probeConfig `yaml:"readiness"`
+	Liveness  *probeConfig `yaml:"liveness"`
+}
+
+type restartConfig struct {
+	// Policy defaults to on-failure
+	Policy     string `yaml:"policy"`
+	MaxRetries int    `yaml:"maxRetries"`
+	Backoff    string `yaml:"backoff"`
+}
+
+type debugConfig struct {
+	// Debugger defaults to delve if no command is set
+	Debugger string   `yaml:"debugger"`
+	Command  string   `yaml:"command"`
+	Asset    string   `yaml:"asset"`
+	Args     []string `yaml:"args"`
+	// Host defaults to 127.0.0.1, so that the debugger is not reachable from the network
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+}
+
+type devDockerConfig struct {
+	dockerConfig `yaml:",inline"`
+	// Workdir defaults to utils.DefaultDevWorkdir
+	Workdir string `yaml:"workdir"`
+	// Sync defaults to utils.DevSyncMount
+	Sync  string   `yaml:"sync"`
+	Ports []string `yaml:"ports"`
+}
+
+type serviceConfig struct {
+	Name      string   `yaml:"name"`
+	Command   string   `yaml:"command"`
+	DependsOn []string `yaml:"dependsOn"`
+	// RestartOnChange defaults to true
+	RestartOnChange *bool         `yaml:"restartOnChange"`
+	Probes          probesConfig  `yaml:"probes"`
+	Restart         restartConfig `yaml:"restart"`
+	Debug           *debugConfig  `yaml:"debug"`
+}
+
+func getProbe(config *probeConfig) (*utils.Probe, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	probe := &utils.Probe{
+		TCP:              config.TCP,
+		HTTP:             config.HTTP,
+		Log:              config.Log,
+		Exec:             config.Exec,
+		FailureThreshold: config.FailureThreshold,
+	}
+
+	if config.Interval != "" {
+		interval, err := time.ParseDuration(config.Interval)
+		if err != nil {
+			return nil, err
+		}
+
+		probe.Interval = interval
+	}
+
+	if config.Timeout != "" {
+		timeout, err := time.ParseDuration(config.Timeout)
+		if err != nil {
+			return nil, err
+		}
+
+		probe.Timeout = timeout
+	}
+
+	return probe, nil
+}
+
+func getService(config serviceConfig) (utils.Service, error) {
+	readiness, err := getProbe(config.Probes.Readiness)
+	if err != nil {
+		return utils.Service{}, err
+	}
+
+	liveness, err := getProbe(config.Probes.Liveness)
+	if err != nil {
+		return utils.Service{}, err
+	}
+
+	service := utils.Service{
+		Name:            config.Name,
+		Command:         config.Command,
+		DependsOn:       config.DependsOn,
+		RestartOnChange: config.RestartOnChange == nil || *config.RestartOnChange,
+		Readiness:       readiness,
+		Liveness:        liveness,
+		RestartPolicy:   config.Restart.Policy,
+		MaxRetries:      config.Restart.MaxRetries,
+	}
+
+	if service.RestartPolicy == "" {
+		service.RestartPolicy = utils.RestartPolicyOnFailure
+	}
+
+	if config.Restart.Backoff != "" {
+		backoff, err := time.ParseDuration(config.Restart.Backoff)
+		if err != nil {
+			return utils.Service{}, err
+		}
+
+		service.Backoff = backoff
+	}
+
+	if config.Debug != nil {
+		service.Debugger = &utils.Debugger{
+			Name:    config.Debug.Debugger,
+			Command: config.Debug.Command,
+			Asset:   config.Debug.Asset,
+			Args:    config.Debug.Args,
+			Host:    config.Debug.Host,
+			Port:    config.Debug.Port,
+		}
+
+		if service.Debugger.Name == "" && service.Debugger.Command == "" {
+			service.Debugger.Name = utils.DebuggerDelve
+		}
+	}
+
+	return service, nil
+}
+
+// getServices returns the services of the dev command flow; the start command is run as the service "start" if there are other services
+func getServices(start serviceConfig, configs []serviceConfig) ([]utils.Service, error) {
+	var services []utils.Service
+	if start.Command != "" {
+		if len(configs) > 0 {
+			start.Name = "start"
+		}
+
+		service, err := getService(start)
+		if err != nil {
+			return nil, err
+		}
+
+		services = append(services, service)
+	}
+
+	for _, config := range configs {
+		service, err := getService(config)
+		if err != nil {
+			return nil, err
+		}
+
+		services = append(services, service)
+	}
+
+	return services, nil
+}
+
+// devStages are the names of the stages of the dev command flow, in the order in which they are run
+var devStages = []string{"generateSources", "build", "unitTests", "integrationTests", "start"}
+
+func isDevStage(stage string) bool {
+	for _, devStage := range devStages {
+		if devStage == stage {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isTestStage returns whether failures of the dev stage are reported without stopping the app from being restarted
+func isTestStage(stage string) bool {
+	return stage == "unitTests" || stage == "integrationTests"
+}
+
+func logStageFailures(err *utils.StageFailuresError, stages []string, message string) {
+	for _, failure := range err.Failures {
+		log.Println("Stage", stages[failure.Stage], "failed"+message+":", failure.Err)
+	}
+}
+
+func getChangedFilesEnv(changedFiles []string, changedFilesList string) []string {
+	return []string{
+		utils.ChangedFilesEnv + "=" + strings.Join(changedFiles, string(os.PathListSeparator)),
+		utils.ChangedFilesListEnv + "=" + changedFilesList,
+	}
+}
+
+func getPathFilters(context string, watch stringList, include string, config watcherConfig) ([]*utils.PathFilter, error) {
+	includeRegex := ""
+	if include != "" {
+		includeRegex = filepath.Join(context, include)
+	}
+
+	ignoreFiles := config.IgnoreFiles
+	if ignoreFiles == nil {
+		ignoreFiles = utils.DefaultIgnoreFiles
+	}
+
+	if len(watch) == 0 {
+		watch = stringList{"."}
+	}
+
+	var filters []*utils.PathFilter
+	for _, root := range watch {
+		filter, err := utils.NewPathFilter(filepath.Join(context, root), includeRegex, config.Include, config.Exclude, ignoreFiles)
+		if err != nil {
+			return nil, err
+		}
+
+		filters = append(filters, filter)
+	}
+
+	return filters, nil
+}
+
+type dockerConfig struct {
+	File    string `yaml:"file"`
+	Context string `yaml:"context"`
+	Tag     string `yaml:"tag"`
+}
+
+// newChangedFilesList creates the file which lists the changed files for the commands of the flows, see getChangedFilesEnv
+func newChangedFilesList() string {
+	changedFilesList, err := ioutil.TempFile("", "dibs-changed-files-*")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := changedFilesList.Close(); err != nil {
+		log.Fatal(err)
+	}
+
+	return changedFilesList.Name()
+}
+
+func writeChangedFilesList(changedFilesList string, relativeChangedFiles []string) {
+	if err := ioutil.WriteFile(changedFilesList, []byte(strings.Join(relativeChangedFiles, "\n")+"\n"), 0666); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// handleInterrupts calls stop and exits once the process is interrupted; other sources, e.g. the console, may interrupt it by sending to interrupt
+func handleInterrupts(interrupt chan os.Signal, stop func()) {
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-interrupt
+
+		// Allow manually killing the process
+		go func() {
+			<-interrupt
+
+			os.Exit(1)
+		}()
+
+		stop()
+
+		os.Exit(0) // The path watcher is blocking
+	}()
+}
+
+// watchPaths calls onChange with the changed files and their paths relative to context whenever the watched files change; it blocks
+func watchPaths(context string, watch stringList, include string, config watcherConfig, onChange func(changedFiles, relativeChangedFiles []string)) {
+	debounce := utils.DefaultPathWatcherDebounce
+	if config.Debounce != "" {
+		var err error
+		debounce, err = time.ParseDuration(config.Debounce)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	filters, err := getPathFilters(context, watch, include, config)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	eventChan := make(chan []string)
+
+	pathWatcher := utils.NewPathWatcher(
+		filters,
+		config.Backend,
+		debounce,
+		eventChan,
+	)
+
+	go func() {
+		for changedFiles := range eventChan {
+			var relativeChangedFiles []string
+			for _, changedFile := range changedFiles {
+				relativeChangedFile, err := filepath.Rel(context, changedFile)
+				if err != nil {
+					log.Fatal(err)
+				}
+
+				relativeChangedFiles = append(relativeChangedFiles, relativeChangedFile)
+			}
+
+			onChange(changedFiles, relativeChangedFiles)
+		}
+	}()
+
+	if err := pathWatcher.Start(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func runCommandWithLog(execLine, dir string, stdoutChan, stderrChan chan string) {
+	command := utils.NewManageableCommand(execLine, dir, stdoutChan, stderrChan)
+
+	if err := command.Start(); err != nil {
+		log.Fatal(err)
+	}
+
+	go handleStdoutAndStderr(stdoutChan, stderrChan)
+
+	if err := command.Wait(); err != nil {
+		if err.Error() == "exit status 2" { // -help
+			return
+		}
+		log.Fatal(err)
+	}
+}
+
+const emulateUsage = `Run the binaries of non-native platforms with their qemu-user binary if no binfmt_misc handler is registered for them.
+Commands which run a path, e.g. .bin/binaries/app-linux-arm64, are prefixed with it; others may use it with DIBS_EMULATOR, e.g. go test -exec "$DIBS_EMULATOR".`
+
+// setupEmulator returns the qemu-user binary which runs the binaries of platform, or an empty string if they can be run
+// natively or by a registered binfmt_misc handler. It is passed to the commands as DIBS_EMULATOR, e.g. for `go test -exec "$DIBS_EMULATOR" ./...`.
+func setupEmulator(platform string) (string, error) {
+	emulator := ""
+	if !utils.IsNativePlatform(platform) {
+		registered, err := utils.IsBinfmtRegistered(utils.BinfmtMiscDir, platform)
+		if err != nil || !registered {
+			emulator, err = utils.GetQEMUUserBinary(platform)
+			if err != nil {
+				return "", fmt.Errorf("could not emulate platform %v: %w", platform, err)
+			}
+		}
+	}
+
+	return emulator, os.Setenv("DIBS_EMULATOR", emulator)
+}
+
+func emulateExecLine(emulator, context, execLine string) string {
+	if emulator == "" || execLine == "" {
+		return execLine
+	}
+
+	return utils.GetEmulatedExecLine(emulator, context, execLine)
+}
+
+// pushAssets pushes assetOut, which may be a file or a dir, as a release of the repo in gitRepoRoot; releaseNotes is used as its body if it exists
+func pushAssets(context, gitRepoRoot, assetOut, releaseNotes string, credentials utils.Credentials, stdoutChan, stderrChan chan string) {
+	h := utils.NewBinaryManager(context, stdoutChan, stderrChan)
+
+	go handleStdoutAndStderr(stdoutChan, stderrChan)
+
+	// Releases must not be published without the notes which have been configured for them
+	notes := ""
+	if releaseNotes != "" {
+		notes = filepath.Join(context, releaseNotes)
+		if _, err := os.Stat(notes); err != nil {
+			log.Fatal("could not read release notes, build them with -buildReleaseNotes first: ", err)
+		}
+	}
+
+	if err := h.Push(
+		credentials.Get("githubUserName"),
+		credentials.Get("githubToken"),
+		credentials.Get("githubRepository"),
+		gitRepoRoot,
+		assetOut,
+		notes,
+	); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func buildAndRunDockerContainer(command, context string, config dockerConfig, privileged bool, stdoutChan, stderrChan chan string) {
+	d := utils.NewDockerManager(context, stdoutChan, stderrChan)
+
+	go handleStdoutAndStderr(stdoutChan, stderrChan)
+
+	if err := d.Build(filepath.Join(context, config.File), filepath.Join(context, config.Context), config.Tag); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := d.Run(config.Tag, command, privileged); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func handleStdoutAndStderr(stdoutChan, stderrChan chan string) {
+	for {
+		select {
+		case stdout := <-stdoutChan:
+			log.Println("STDOUT", stdout)
+		case stderr := <-stderrChan:
+			log.Println("STDERR", stderr)
+		}
+	}
+}
+
+// syncDevContainer copies the list of changed files and, if the context is not mounted, the changed files into the dev container
+func syncDevContainer(d *utils.DockerManager, containerID string, config devDockerConfig, context, changedFilesList string, changedFiles []string) {
+	if err := d.CopyToContainer(containerID, changedFilesList, utils.DevChangedFilesList); err != nil {
+		log.Println("Could not sync the list of changed files:", err)
+	}
+
+	if config.Sync != utils.DevSyncCopy {
+		return
+	}
+
+	for _, changedFile := range changedFiles {
+		relativeChangedFile, err := filepath.Rel(context, changedFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		target := path.Join(config.Workdir, filepath.ToSlash(relativeChangedFile))
+
+		if _, err := os.Stat(changedFile); os.IsNotExist(err) {
+			err = d.RemoveFromContainer(containerID, target)
+		} else {
+			err = d.CopyToContainer(containerID, changedFile, target)
+		}
+
+		// Files in new directories can't be copied on their own, so the whole context is synced instead
+		if err != nil {
+			log.Println("Could not sync", relativeChangedFile, "to the dev container, syncing the whole context:", err)
+
+			if err := d.CopyToContainer(containerID, context+string(filepath.Separator)+".", config.Workdir); err != nil {
+				log.Println("Could not sync the context to the dev container:", err)
+			}
+
+			return
+		}
+	}
+}
+
+// handleDevStdoutAndStderr also publishes the lines to the dev API, if it is enabled
+func handleDevStdoutAndStderr(stdoutChan, stderrChan chan string, devAPI *utils.DevAPIServer) {
+	for {
+		select {
+		case stdout := <-stdoutChan:
+			log.Println("STDOUT", stdout)
+
+			if devAPI != nil {
+				devAPI.Publish(utils.StdoutStream, stdout)
+			}
+		case stderr := <-stderrChan:
+			log.Println("STDERR", stderr)
+
+			if devAPI != nil {
+				devAPI.Publish(utils.StderrStream, stderr)
+			}
+		}
+	}
+}
+
+func verify(args []string) {
+	var (
+		dist      string
+		chartDist string
+		publicKey string
+		gpg       bool
+	)
+
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	flags.StringVar(&dist, "dist", ".bin/release", "The directory which contains the release archives, checksums, provenance files and signatures; it must contain a SHA256SUMS file")
+	flags.StringVar(&chartDist, "chartDist", "", "The directory which contains the Helm charts and their signatures, e.g. .bin/chart; if it is set, the charts' signatures are verified as well")
+	flags.StringVar(&publicKey, "publicKey", os.Getenv("DIBS_SIGNING_PUBLIC_KEY"), `The base64-encoded ed25519 public key to verify the signatures with.
+This may also be set with the DIBS_SIGNING_PUBLIC_KEY env variable.`)
+	flags.BoolVar(&gpg, "gpg", false, "Verify GPG signatures using the local GPG keyring")
+	if err := flags.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+	go handleStdoutAndStderr(stdoutChan, stderrChan)
+
+	// Nothing may be skipped silently, as a verifier which passes by default can't be trusted
+	if _, err := os.Stat(dist); err != nil {
+		log.Fatal(err)
+	}
+
+	a := utils.NewArchiveManager(dist, stdoutChan, stderrChan)
+	if err := a.VerifyChecksums(dist); err != nil {
+		log.Fatal("could not verify ", utils.ChecksumsFileName, ": ", err)
+	}
+
+	log.Println("Verified", utils.ChecksumsFileName)
+
+	provenanceFiles, err := filepath.Glob(filepath.Join(dist, "*"+utils.ProvenanceExtension))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	p := utils.NewProvenanceManager(dist, stdoutChan, stderrChan)
+	for _, provenanceFile := range provenanceFiles {
+		if err := p.Verify(provenanceFile); err != nil {
+			log.Fatal(err)
+		}
+
+		log.Println("Verified provenance", provenanceFile)
+	}
+
+	signableFiles, err := utils.GetSignableFiles(dist)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if chartDist != "" {
+		if _, err := os.Stat(chartDist); err != nil {
+			log.Fatal(err)
+		}
+
+		charts, err := utils.GetSignableCharts(chartDist)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if len(charts) == 0 {
+			log.Fatal("could not find any charts in ", chartDist)
+		}
+
+		signableFiles = append(signableFiles, charts...)
+	}
+
+	if publicKey == "" && !gpg {
+		if signatures := utils.GetSignatures(signableFiles); len(signatures) > 0 {
+			log.Fatal("found signatures ", strings.Join(signatures, ", "), ", but neither -publicKey nor -gpg is set")
+		}
+
+		// Charts have no checksums, so they can only be verified with their signatures
+		if chartDist != "" {
+			log.Fatal("-chartDist requires -publicKey or -gpg")
+		}
+
+		return
+	}
+
+	// The paths of the files include the dists, so GPG is run in the current directory
+	s := utils.NewSignatureManager("", stdoutChan, stderrChan)
+	for _, signableFile := range signableFiles {
+		if gpg {
+			err = s.VerifyGPG(signableFile)
+		} else {
+			err = s.Verify(publicKey, signableFile)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Println("Verified signature of", signableFile)
+	}
+}
+
+func keygen() {
+	privateKey, publicKey, err := utils.GenerateSigningKeys()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println("DIBS_SIGNING_KEY=" + privateKey)
+	fmt.Println("DIBS_SIGNING_PUBLIC_KEY=" + publicKey)
+}
+
+func test(args []string) {
+	var (
+		configFilePath       string
+		context              string
+		target               string
+		platform             string
+		watch                bool
+		emulate              bool
+		skipUnitTests        bool
+		skipIntegrationTests bool
+	)
+
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	flags.StringVar(&configFilePath, "configFile", "dibs.yaml", "The config file to use")
+	flags.StringVar(&context, "context", "", "The directory to run the tests in; defaults to the directory of the config file")
+	flags.StringVar(&target, "target", runtime.GOOS, `The name of the target to use.
+This may also be set with the DIBS_TARGET env variable.`)
+	flags.StringVar(&platform, "platform", runtime.GOOS+"/"+runtime.GOARCH, `The identifier of the platform to use.
+This may also be set with the TARGETPLATFORM env variable.`)
+	flags.BoolVar(&watch, "watch", false, `Rerun the tests when the platform's watched files change instead of exiting.
+The changed files are passed to the tests like in the development flow.`)
+	flags.BoolVar(&emulate, "emulate", false, emulateUsage)
+	flags.BoolVar(&skipUnitTests, "skipUnitTests", false, "Skip the unit tests for the project")
+	flags.BoolVar(&skipIntegrationTests, "skipIntegrationTests", false, "Skip the integration tests for the project")
+	if err := flags.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+
+	if targetFromEnv := os.Getenv("DIBS_TARGET"); targetFromEnv != "" {
+		target = targetFromEnv
+	}
+	if platformFromEnv := os.Getenv("TARGETPLATFORM"); platformFromEnv != "" {
+		platform = platformFromEnv
+	}
+
+	pwd, err := os.Getwd()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if context == "" {
+		context = filepath.Join(pwd, configFilePath, "..")
+	}
+
+	configFile, err := ioutil.ReadFile(configFilePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	configs := Config{}
+	if err := yaml.Unmarshal(configFile, &configs); err != nil {
+		log.Fatal(err)
+	}
+
+	for _, targetConfig := range configs.Targets {
+		if targetConfig.Name != target {
+			continue
+		}
+
+		for _, platformConfig := range targetConfig.Platforms {
+			if platformConfig.Identifier != platform {
+				continue
+			}
+
+			for _, envVariableToSet := range [][]string{{"DIBS_TARGET", target}, {"TARGETPLATFORM", platform}} {
+				if err := os.Setenv(envVariableToSet[0], envVariableToSet[1]); err != nil {
+					log.Fatal(err)
+				}
+			}
+
+			emulator := ""
+			if emulate {
+				emulator, err = setupEmulator(platform)
+				if err != nil {
+					log.Fatal(err)
+				}
+			}
+
+			var (
+				commandsToRun []string
+				stagesToRun   []string
+			)
+			for _, stage := range []struct {
+				name    string
+				command string
+				skip    bool
+			}{
+				{"unitTests", platformConfig.Commands.UnitTests, skipUnitTests},
+				{"integrationTests", platformConfig.Commands.IntegrationTests, skipIntegrationTests},
+			} {
+				if stage.command == "" || stage.skip {
+					continue
+				}
+
+				commandsToRun = append(commandsToRun, emulateExecLine(emulator, context, stage.command))
+				stagesToRun = append(stagesToRun, stage.name)
+			}
+
+			if len(commandsToRun) == 0 {
+				log.Fatal("there are no tests to run for platform ", platform, " of target ", target)
+			}
+
+			changedFilesList := newChangedFilesList()
+			defer os.Remove(changedFilesList)
+
+			stdoutChan, stderrChan := make(chan string), make(chan string)
+			go handleStdoutAndStderr(stdoutChan, stderrChan)
+
+			commandFlow, err := utils.NewServiceCommandFlow(commandsToRun, nil, context, stdoutChan, stderrChan)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			// All tests are run, even if some of them fail
+			for i := range stagesToRun {
+				commandFlow.SetAllowFailure(i, true)
+			}
+
+			commandFlow.SetEnv(getChangedFilesEnv(nil, changedFilesList))
+
+			// reportFailures returns whether all tests have passed
+			reportFailures := func(err error) bool {
+				if err == nil {
+					log.Println("All tests passed")
+
+					return true
+				}
+
+				failuresErr, ok := err.(*utils.StageFailuresError)
+				if !ok {
+					log.Fatal(err)
+				}
+
+				logStageFailures(failuresErr, stagesToRun, "")
+
+				return false
+			}
+
+			passed := reportFailures(commandFlow.Start())
+			if !watch {
+				if !passed {
+					_ = os.Remove(changedFilesList)
+
+					os.Exit(1)
+				}
+
+				return
 			}
+
+			handleInterrupts(make(chan os.Signal, 2), func() {
+				if err := commandFlow.Stop(); err != nil {
+					log.Fatal(err)
+				}
+
+				_ = os.Remove(changedFilesList)
+			})
+
+			watchPaths(context, platformConfig.Paths.Watch, platformConfig.Paths.Include, platformConfig.Watcher, func(_, relativeChangedFiles []string) {
+				writeChangedFilesList(changedFilesList, relativeChangedFiles)
+
+				log.Println("Rerunning the tests because of changes to", strings.Join(relativeChangedFiles, ", "))
+
+				reportFailures(commandFlow.RunStages(0, len(stagesToRun), getChangedFilesEnv(relativeChangedFiles, changedFilesList)))
+			})
+
+			return
 		}
 	}
+
+	log.Fatal("could not find platform ", platform, " of target ", target)
 }
 
-type dockerConfig struct {
-	File    string `yaml:"file"`
-	Context string `yaml:"context"`
-	Tag     string `yaml:"tag"`
+// doctorStages are the stage flags whose prerequisites "dibs doctor" checks
+var doctorStages = []string{"dev", "generateSources", "build", "unitTests", "integrationTests", "imageTests", "chartTests", "verifyChart", "publish", "buildImage", "pushImage", "buildManifest", "pushManifest", "buildChart", "pushChart", "packageBinary", "buildReleaseNotes", "sign", "pushBinary"}
+
+// doctorTools are the tools which stages depend on; Helm, chart releasing and Git are built in
+var doctorTools = map[string]utils.Tool{
+	"sh": {
+		Name:    "sh",
+		Install: "install a POSIX shell, e.g. dash or bash",
+	},
+	"docker": {
+		Name:        "docker",
+		VersionArgs: []string{"version", "--format", "{{.Client.Version}}"},
+		MinVersion:  "19.03.0",
+		Install:     "install Docker, see https://docs.docker.com/get-docker/",
+	},
+	"buildx": {
+		Name:        "docker-buildx",
+		VersionArgs: []string{"version"},
+		MinVersion:  "0.3.0",
+		Install:     "install the buildx plugin, see https://github.com/docker/buildx#installing",
+	},
+	"ghr": {
+		Name:        "ghr",
+		VersionArgs: []string{"-version"},
+		MinVersion:  "0.13.0",
+		Install:     "install it with `go install github.com/tcnksm/ghr@latest`",
+	},
+	"gpg": {
+		Name:        "gpg",
+		VersionArgs: []string{"--version"},
+		Install:     "install GnuPG, e.g. with your package manager",
+	},
+	"dlv": {
+		Name:        "dlv",
+		VersionArgs: []string{"version"},
+		Install:     "install it with `go install github.com/go-delve/delve/cmd/dlv@latest`",
+	},
 }
 
-func runCommandWithLog(execLine, dir string, stdoutChan, stderrChan chan string) {
-	command := utils.NewManageableCommand(execLine, dir, stdoutChan, stderrChan)
+// doctorDependencies maps checks to the check which has to succeed before they can be run
+var doctorDependencies = map[string]string{
+	"docker daemon":  "docker",
+	"buildx":         "docker",
+	"buildx builder": "buildx",
+}
 
-	if err := command.Start(); err != nil {
-		log.Fatal(err)
+// doctorRequirements collects the stages which need each prerequisite in the order in which they were added
+type doctorRequirements struct {
+	names  []string
+	stages map[string][]string
+}
+
+func (r *doctorRequirements) add(name string, stages ...string) {
+	if r.stages == nil {
+		r.stages = map[string][]string{}
 	}
 
-	go handleStdoutAndStderr(stdoutChan, stderrChan)
+	if _, ok := r.stages[name]; !ok {
+		r.names = append(r.names, name)
+	}
 
-	if err := command.Wait(); err != nil {
-		if err.Error() == "exit status 2" { // -help
-			return
+	for _, stage := range stages {
+		found := false
+		for _, existingStage := range r.stages[name] {
+			if existingStage == stage {
+				found = true
+
+				break
+			}
+		}
+
+		if !found {
+			r.stages[name] = append(r.stages[name], stage)
 		}
-		log.Fatal(err)
 	}
 }
 
-func buildAndRunDockerContainer(command, context string, config dockerConfig, privileged bool, stdoutChan, stderrChan chan string) {
-	d := utils.NewDockerManager(context, stdoutChan, stderrChan)
+func doctor(args []string) {
+	var (
+		configFilePath string
+		target         string
+		platform       string
+		jsonOutput     bool
+		docker         bool
+		debugFlag      bool
+		emulate        bool
+	)
 
-	go handleStdoutAndStderr(stdoutChan, stderrChan)
+	flags := flag.NewFlagSet("doctor", flag.ExitOnError)
+	flags.StringVar(&configFilePath, "configFile", "dibs.yaml", "The config file to use")
+	flags.StringVar(&target, "target", runtime.GOOS, `The name of the target to use.
+This may also be set with the DIBS_TARGET env variable; a value of "*" checks all targets.`)
+	flags.StringVar(&platform, "platform", runtime.GOOS+"/"+runtime.GOARCH, `The identifier of the platform to use.
+This may also be set with the TARGETPLATFORM env variable; a value of "*" checks all platforms.`)
+	flags.BoolVar(&jsonOutput, "json", false, "Print the results as JSON")
+	flags.BoolVar(&docker, "docker", false, "Check the prerequisites of running the stages in Docker")
+	flags.BoolVar(&debugFlag, "debug", false, "Check the prerequisites of debugging the app in the development flow")
+	flags.BoolVar(&emulate, "emulate", false, "Check the prerequisites of emulating the commands of non-native platforms")
+	selectedStages := map[string]*bool{}
+	for _, stage := range doctorStages {
+		selectedStages[stage] = flags.Bool(stage, false, "Check the prerequisites of -"+stage)
+	}
+	if err := flags.Parse(args); err != nil {
+		log.Fatal(err)
+	}
 
-	if err := d.Build(filepath.Join(context, config.File), filepath.Join(context, config.Context), config.Tag); err != nil {
+	if targetFromEnv := os.Getenv("DIBS_TARGET"); targetFromEnv != "" {
+		target = targetFromEnv
+	}
+	if platformFromEnv := os.Getenv("TARGETPLATFORM"); platformFromEnv != "" {
+		platform = platformFromEnv
+	}
+	if err := os.Setenv("DOCKER_CLI_EXPERIMENTAL", "enabled"); err != nil {
 		log.Fatal(err)
 	}
 
-	if err := d.Run(config.Tag, command, privileged); err != nil {
+	// If no stages are selected, all stages which the config file configures are checked
+	allStages := true
+	for _, selected := range selectedStages {
+		if *selected {
+			allStages = false
+		}
+	}
+
+	pwd, err := os.Getwd()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	context := filepath.Join(pwd, configFilePath, "..")
+
+	configFile, err := ioutil.ReadFile(configFilePath)
+	if err != nil {
 		log.Fatal(err)
 	}
+
+	configs := Config{}
+	if err := yaml.Unmarshal(configFile, &configs); err != nil {
+		log.Fatal(err)
+	}
+
+	// GPG is only used for signing if no ed25519 key is set
+	_, signingKeyConfigured := configs.Credentials["signingKey"]
+	_, signingGPGKeyIDConfigured := configs.Credentials["signingGPGKeyID"]
+	signingKeyConfigured = signingKeyConfigured || os.Getenv(defaultCredentialEnvVariables["signingKey"]) != ""
+	signingGPGKeyIDConfigured = signingGPGKeyIDConfigured || os.Getenv(defaultCredentialEnvVariables["signingGPGKeyID"]) != ""
+
+	var (
+		requirements    doctorRequirements
+		buildPlatforms  []string
+		emulatorTools   []utils.Tool
+		emulatorStages  = map[string][]string{}
+		platformsFound  bool
+		dockerStageRuns = map[string]bool{"build": true, "unitTests": true, "integrationTests": true, "chartTests": true, "publish": true, "dev": true}
+	)
+	for _, targetConfig := range configs.Targets {
+		if targetConfig.Name != target && target != "*" {
+			continue
+		}
+
+		for _, platformConfig := range targetConfig.Platforms {
+			if platformConfig.Identifier != platform && platform != "*" {
+				continue
+			}
+
+			platformsFound = true
+
+			configuredStages := map[string]bool{
+				"dev":               platformConfig.Commands.Start != "",
+				"generateSources":   platformConfig.Commands.GenerateSources != "",
+				"build":             platformConfig.Commands.Build != "" || platformConfig.Docker.Build.Tag != "",
+				"unitTests":         platformConfig.Commands.UnitTests != "" || platformConfig.Docker.UnitTests.Tag != "",
+				"integrationTests":  platformConfig.Commands.IntegrationTests != "" || platformConfig.Docker.IntegrationTests.Tag != "",
+				"imageTests":        platformConfig.Commands.ImageTests != "",
+				"chartTests":        platformConfig.Commands.ChartTests != "" || platformConfig.Docker.ChartTests.Tag != "",
+				"verifyChart":       targetConfig.Helm.Src != "",
+				"publish":           platformConfig.Commands.Publish != "" || platformConfig.Docker.Publish.Tag != "",
+				"buildImage":        platformConfig.Docker.Build.Tag != "",
+				"pushImage":         platformConfig.Docker.Build.Tag != "",
+				"buildManifest":     targetConfig.DockerManifest != "",
+				"pushManifest":      targetConfig.DockerManifest != "",
+				"buildChart":        targetConfig.Helm.Src != "",
+				"pushChart":         targetConfig.Helm.Src != "",
+				"packageBinary":     targetConfig.Release.Dist != "",
+				"buildReleaseNotes": targetConfig.Release.Notes != "",
+				"sign":              targetConfig.Release.Dist != "" && (signingKeyConfigured || signingGPGKeyIDConfigured),
+				"pushBinary":        platformConfig.Paths.AssetOut != "" || targetConfig.Release.Dist != "",
+			}
+
+			usesBuildx := false
+			for _, stage := range doctorStages {
+				if !(*selectedStages[stage] || (allStages && configuredStages[stage])) {
+					continue
+				}
+
+				switch stage {
+				case "verifyChart", "buildChart", "pushChart", "packageBinary", "buildReleaseNotes", "sign":
+				default:
+					// All other stages run commands with sh
+					requirements.add("sh", stage)
+				}
+
+				if (docker && dockerStageRuns[stage]) || stage == "buildImage" {
+					requirements.add("docker", stage)
+					requirements.add("docker daemon", stage)
+					requirements.add("buildx", stage)
+					requirements.add("buildx builder", stage)
+					requirements.add("binfmt_misc", stage)
+
+					usesBuildx = true
+				}
+
+				switch stage {
+				case "pushImage", "buildManifest", "pushManifest":
+					requirements.add("docker", stage)
+					requirements.add("docker daemon", stage)
+				case "buildChart":
+					// The digest of the injected image is resolved with `docker buildx imagetools`
+					if targetConfig.Helm.InjectImage {
+						requirements.add("docker", stage)
+						requirements.add("docker daemon", stage)
+						requirements.add("buildx", stage)
+					}
+				case "pushBinary":
+					requirements.add("ghr", stage)
+				case "sign":
+					if !signingKeyConfigured && signingGPGKeyIDConfigured {
+						requirements.add("sh", stage)
+						requirements.add("gpg", stage)
+					}
+				case "dev":
+					if debugFlag && !docker {
+						debugs := []*debugConfig{platformConfig.Debug}
+						for _, service := range platformConfig.Services {
+							debugs = append(debugs, service.Debug)
+						}
+
+						for _, debug := range debugs {
+							if debug != nil && debug.Command == "" && (debug.Debugger == "" || debug.Debugger == utils.DebuggerDelve) {
+								requirements.add("dlv", stage)
+							}
+						}
+					}
+				}
+
+				if emulate && !docker && !utils.IsNativePlatform(platformConfig.Identifier) && (stage == "dev" || stage == "unitTests" || stage == "integrationTests") {
+					if registered, err := utils.IsBinfmtRegistered(utils.BinfmtMiscDir, platformConfig.Identifier); err == nil && registered {
+						continue
+					}
+
+					tool, err := utils.GetQEMUUserTool(platformConfig.Identifier)
+					if err != nil {
+						log.Fatal(err)
+					}
+
+					if _, ok := emulatorStages[tool.Name]; !ok {
+						emulatorTools = append(emulatorTools, tool)
+					}
+					emulatorStages[tool.Name] = append(emulatorStages[tool.Name], stage)
+				}
+			}
+
+			if usesBuildx {
+				buildPlatforms = append(buildPlatforms, platformConfig.Identifier)
+			}
+		}
+	}
+
+	if !platformsFound {
+		log.Fatal("could not find platform ", platform, " of target ", target)
+	}
+
+	d := utils.NewDoctorManager(context)
+
+	var (
+		checks []utils.DoctorCheck
+		failed = map[string]bool{}
+	)
+	for _, name := range requirements.names {
+		stages := requirements.stages[name]
+
+		// Checks which depend on a failed check would only repeat its error
+		if dependency := doctorDependencies[name]; dependency != "" && failed[dependency] {
+			checks = append(checks, utils.DoctorCheck{
+				Name:    name,
+				Status:  utils.DoctorStatusError,
+				Stages:  stages,
+				Message: "not checked because the " + dependency + " check has failed",
+			})
+			failed[name] = true
+
+			continue
+		}
+
+		switch name {
+		case "docker daemon":
+			checks = append(checks, d.CheckDockerDaemon(stages))
+		case "buildx builder":
+			checks = append(checks, d.CheckBuildxBuilder(buildPlatforms, stages))
+		case "binfmt_misc":
+			checks = append(checks, d.CheckEmulation(utils.BinfmtMiscDir, buildPlatforms, stages))
+		case "buildx":
+			// buildx is a plugin of the Docker CLI, so its version is checked with `docker buildx version`
+			tool := doctorTools[name]
+			check := d.CheckTool(utils.Tool{Name: "docker", VersionArgs: append([]string{"buildx"}, tool.VersionArgs...), MinVersion: tool.MinVersion, Install: tool.Install}, stages)
+			check.Name = name
+
+			checks = append(checks, check)
+		default:
+			checks = append(checks, d.CheckTool(doctorTools[name], stages))
+		}
+
+		failed[name] = checks[len(checks)-1].Status == utils.DoctorStatusError
+	}
+	for _, tool := range emulatorTools {
+		checks = append(checks, d.CheckTool(tool, emulatorStages[tool.Name]))
+	}
+
+	report := utils.NewDoctorReport(checks)
+
+	if jsonOutput {
+		output, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Println(string(output))
+	} else {
+		if len(report.Checks) == 0 {
+			fmt.Println("No prerequisites to check for the selected stages")
+		}
+
+		for _, check := range report.Checks {
+			version := ""
+			if check.Version != "" {
+				version = " " + check.Version
+			}
+
+			fmt.Printf("[%v] %v%v: %v (needed by %v)\n", check.Status, check.Name, version, check.Message, strings.Join(check.Stages, ", "))
+			if check.Hint != "" {
+				fmt.Printf("  To fix this, %v\n", check.Hint)
+			}
+		}
+	}
+
+	if !report.OK {
+		os.Exit(1)
+	}
 }
 
-func handleStdoutAndStderr(stdoutChan, stderrChan chan string) {
-	for {
-		select {
-		case stdout := <-stdoutChan:
-			log.Println("STDOUT", stdout)
-		case stderr := <-stderrChan:
-			log.Println("STDERR", stderr)
+func initProject(args []string) {
+	var (
+		name         string
+		image        string
+		language     string
+		platforms    string
+		templatesDir string
+		force        bool
+	)
+
+	pwd, err := os.Getwd()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	flags.StringVar(&name, "name", "", "The name of the project, which is used for its binaries, images and Helm chart; defaults to the name of the current directory")
+	flags.StringVar(&image, "image", "", "The repository of the project's Docker images, e.g. pojntfx/app; defaults to the name")
+	flags.StringVar(&language, "language", "go", "The language template to use (go, node, rust, python or c)")
+	flags.StringVar(&platforms, "platforms", "linux/amd64,linux/arm64", `The comma-separated identifiers of the platforms to generate.
+A target is generated for each OS; Docker images and the Helm chart are only generated for Linux.`)
+	flags.StringVar(&templatesDir, "templates", "", `A directory with templates which override the embedded ones.
+Its files override the embedded files with the same paths in its common and language directories, e.g. go/Dockerfile; it may also add languages.
+This may also be set with the DIBS_TEMPLATES env variable.`)
+	flags.BoolVar(&force, "force", false, "Overwrite existing files")
+	if err := flags.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+
+	if name == "" {
+		name = filepath.Base(pwd)
+	}
+	if templatesDirFromEnv := os.Getenv("DIBS_TEMPLATES"); templatesDir == "" && templatesDirFromEnv != "" {
+		templatesDir = templatesDirFromEnv
+	}
+
+	var platformIdentifiers []string
+	for _, platform := range strings.Split(platforms, ",") {
+		if platform = strings.TrimSpace(platform); platform != "" {
+			platformIdentifiers = append(platformIdentifiers, platform)
 		}
 	}
+
+	data, err := utils.NewInitData(name, image, language, platformIdentifiers)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+
+	go handleStdoutAndStderr(stdoutChan, stderrChan)
+
+	written, err := utils.NewInitManager(pwd, templatesDir, stdoutChan, stderrChan).Init(language, data, force)
+	for _, file := range written {
+		log.Println("Wrote", file)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "verify":
+			verify(os.Args[2:])
+
+			return
+		case "keygen":
+			keygen()
+
+			return
+		case "test":
+			test(os.Args[2:])
+
+			return
+		case "doctor":
+			doctor(os.Args[2:])
+
+			return
+		case "init":
+			initProject(os.Args[2:])
+
+			return
+		}
+	}
+
 	var (
-		configFilePath      string
-		context             string
-		dev                 bool
-		generateSources     bool
-		build               bool
-		buildImage          bool
-		buildManifest       bool
-		buildChart          bool
-		unitTests           bool
-		integrationTests    bool
-		imageTests          bool
-		chartTests          bool
-		publish             bool
-		pushBinary          bool
-		pushImage           bool
-		pushManifest        bool
-		pushChart           bool
-		docker              bool
-		target              string
-		platform            string
-		skipTests           bool
-		skipGenerateSources bool
+		configFilePath       string
+		context              string
+		dev                  bool
+		generateSources      bool
+		build                bool
+		buildImage           bool
+		buildManifest        bool
+		buildChart           bool
+		unitTests            bool
+		integrationTests     bool
+		imageTests           bool
+		chartTests           bool
+		verifyChart          bool
+		publish              bool
+		packageBinary        bool
+		buildReleaseNotes    bool
+		provenance           bool
+		sign                 bool
+		pushBinary           bool
+		pushImage            bool
+		pushManifest         bool
+		pushChart            bool
+		docker               bool
+		target               string
+		platform             string
+		skipTests            bool
+		skipGenerateSources  bool
+		skipUnitTests        bool
+		skipIntegrationTests bool
+		devAPIAddress        string
+		debugFlag            bool
+		emulate              bool
+		skipEmulationCheck   bool
 	)
 
 	flag.StringVar(&configFilePath, "configFile", "dibs.yaml", "The config file to use")
 	flag.StringVar(&context, "context", "", "The config file to use")
-	flag.BoolVar(&docker, "docker", false, "Run in Docker")
-	flag.BoolVar(&dev, "dev", false, "Start the development flow for the project")
+	flag.BoolVar(&docker, "docker", false, `Run in Docker.
+With -dev, the commands are run in a container of the platform's docker.dev image, which is built once and kept running while the flow is restarted;
+the context is mounted into it or, if docker.dev.sync is copy, copied into it along with the changed files. The container is removed on exit.`)
+	flag.BoolVar(&dev, "dev", false, `Start the development flow for the project.
+When watched files change, the flow is restarted from the earliest stage which the platform's watcher.stages map them to.
+The running app is only restarted once all restarted stages before it have succeeded.
+If the platform has services, they are started after the other stages in the order of their dependsOn and their log lines are prefixed with their names;
+services with restartOnChange set to false keep running when the flow is restarted.
+The readiness probes of the start command (probes) and of the services are checked after they have been started,
+and services which depend on them are only started once they are ready; if a liveness probe fails, the service is restarted with an exponential backoff.
+Services which exit are restarted according to their restart.policy (never, on-failure or always; defaults to on-failure) until they reach restart.maxRetries.
+The changed files are passed to the commands in the DIBS_CHANGED_FILES env variable (separated by the path list separator)
+and in the file at the path in the DIBS_CHANGED_FILES_LIST env variable (one per line).
+The unit and integration tests are run before the app is restarted; if they fail, the failures are logged, but the app is restarted anyway.
+If stdin is a terminal, the flow can be controlled with keys, e.g. to restart it, rerun the tests or toggle -skipTests and DIBS_DEBUG;
+press h to show all keys. To only rerun the tests on changes, use "dibs test -watch".`)
+	flag.StringVar(&devAPIAddress, "devAPI", "", `Serve a local HTTP/JSON API to control the development flow on this address, e.g. localhost:31442 or unix:/tmp/dibs.sock.
+GET /status returns the status of the stages and services, POST /restart?stage=build restarts the flow from a stage,
+GET /logs streams the logs as server-sent events and POST /stop stops the flow; the POST requests must set the X-Dibs-Dev-API header.
+Addresses without a host, e.g. :31442, listen on localhost.`)
+	flag.BoolVar(&debugFlag, "debug", false, `Debug the app in the development flow; this may also be enabled with DIBS_DEBUG=true, which is passed to the commands.
+If the platform has a debug section, the start command is replaced with its debugger (delve or a command template with {{.Asset}}, {{.Args}}, {{.Host}} and {{.Port}}),
+which launches the built asset (debug.asset, defaults to paths.assetOut) and listens on debug.host (defaults to 127.0.0.1) and debug.port (defaults to 31441); services support the same section.
+The debugger is stopped gracefully and relaunched once its port is free when the flow is restarted.`)
+	flag.BoolVar(&emulate, "emulate", false, emulateUsage+`
+This applies to the unit tests, integration tests and start commands which are not run in Docker.`)
+	flag.BoolVar(&skipEmulationCheck, "skipEmulationCheck", false, `Don't check whether binfmt_misc handlers are registered for the non-native platforms before building or running them in Docker`)
 	flag.BoolVar(&skipTests, "skipTests", false, "Skip the tests for the project")
+	flag.BoolVar(&skipUnitTests, "skipUnitTests", false, "Skip the unit tests for the project in the development flow")
+	flag.BoolVar(&skipIntegrationTests, "skipIntegrationTests", false, "Skip the integration tests for the project in the development flow")
 	flag.BoolVar(&skipGenerateSources, "skipGenerateSources", false, "Don't generate the sources for the project")
 	flag.BoolVar(&generateSources, "generateSources", false, "Generate the sources for the project")
 	flag.BoolVar(&build, "build", false, "Build the project")
@@ -142,25 +1447,52 @@ It will add all images of the specified platforms; to add all, set -platform to
 	flag.BoolVar(&integrationTests, "integrationTests", false, "Run the integration tests of the project")
 	flag.BoolVar(&imageTests, "imageTests", false, "Run the image tests of the project")
 	flag.BoolVar(&chartTests, "chartTests", false, "Run the chart tests of the project")
+	flag.BoolVar(&verifyChart, "verifyChart", false, `Verify the Helm chart of the project without a cluster.
+It lints the chart, renders its templates with each of the target's helm.valuesFiles and the platform's image tag
+and validates the rendered manifests against the Kubernetes object schemas.`)
 	flag.BoolVar(&publish, "publish", false, "Publish the project")
 	flag.BoolVar(&pushImage, "pushImage", false, "Push the Docker image of the project")
 	flag.BoolVar(&pushManifest, "pushManifest", false, "Push the Docker manifest of the project")
-	flag.BoolVar(&buildChart, "buildChart", false, "Build the Helm chart of the project")
+	flag.BoolVar(&buildChart, "buildChart", false, `Build the Helm chart of the project.
+If the target's helm.injectImage is set, the dockerManifest (and its digest, if it has been pushed) is written into the chart's values.`)
 	flag.BoolVar(&pushChart, "pushChart", false, `Push the Helm chart of the project.
-This command requires the following env variables to be set:
-- DIBS_GIT_USER_NAME
-- DIBS_GIT_USER_EMAIL
-- DIBS_GIT_COMMIT_MESSAGE
-- DIBS_GITHUB_USER_NAME
-- DIBS_GITHUB_TOKEN
-- DIBS_GITHUB_REPOSITORY_NAME
-- DIBS_GITHUB_REPOSITORY_URL
-- DIBS_GITHUB_PAGES_URL`)
+Credentials are read from the credentials section of the config file or, if they are not configured there, from the env variables in parentheses.
+If the target has a helm.repository, the chart index is committed to and pushed to its Git repository.
+The following credentials may be set for it:
+- gitPassword (DIBS_GIT_PASSWORD, for HTTP repositories)
+- sshKeyPassword (DIBS_SSH_KEY_PASSWORD, for SSH repositories with an encrypted helm.repository.sshKey)
+- githubToken (DIBS_GITHUB_TOKEN, required if helm.repository.github is set; the charts are uploaded to GitHub releases)
+Otherwise, the charts are uploaded to GitHub releases and the index is pushed to the GitHub pages repository.
+The index is generated by dibs, so chart-releaser (cr) doesn't have to be installed; this command requires the following credentials to be set:
+- gitUserName (DIBS_GIT_USER_NAME)
+- gitUserEmail (DIBS_GIT_USER_EMAIL)
+- gitCommitMessage (DIBS_GIT_COMMIT_MESSAGE)
+- githubUserName (DIBS_GITHUB_USER_NAME)
+- githubToken (DIBS_GITHUB_TOKEN)
+- githubRepositoryName (DIBS_GITHUB_REPOSITORY_NAME)
+- githubRepositoryURL (DIBS_GITHUB_REPOSITORY_URL)
+- githubPagesURL (DIBS_GITHUB_PAGES_URL)
+If the target has a helm.ociRegistry, the chart is pushed to it instead.
+The registry's credentials may be set with the following credentials; if they are not set, the Docker config is used:
+- ociUsername (DIBS_OCI_USERNAME)
+- ociPassword (DIBS_OCI_PASSWORD)`)
+	flag.BoolVar(&packageBinary, "packageBinary", false, `Package the binary of the project into a release archive.
+The archives of earlier releases are removed from the target's release.dist first; a SHA256SUMS file for the packaged archives is written afterwards.`)
+	flag.BoolVar(&buildReleaseNotes, "buildReleaseNotes", false, `Generate release notes from the commits since the previous semver tag into the target's release.notes.
+The commits are grouped by their Conventional Commit type.`)
+	flag.BoolVar(&provenance, "provenance", false, `Write a provenance file for each release archive while packaging it.
+It records the config file, Git commit, commands and input hashes of the platform.`)
+	flag.BoolVar(&sign, "sign", false, `Sign the release archives, checksums, provenance files and Helm charts of the project.
+This command requires one of the following credentials (or env variables) to be set:
+- signingKey (DIBS_SIGNING_KEY, a base64-encoded ed25519 key, see "dibs keygen")
+- signingGPGKeyID (DIBS_SIGNING_GPG_KEY_ID, a key in the local GPG keyring)`)
 	flag.BoolVar(&pushBinary, "pushBinary", false, `Push the binary of the project.
-This command requires the following env variables to be set:
-- DIBS_GITHUB_USER_NAME
-- DIBS_GITHUB_TOKEN
-- DIBS_GITHUB_REPOSITORY`)
+If the target has a release.dist, it is pushed once after the binaries of all platforms have been packaged and signed instead.
+If the target has release.notes, they are used as the release's body and must have been built with -buildReleaseNotes; only GitHub releases are supported.
+This command requires the following credentials (or env variables) to be set:
+- githubUserName (DIBS_GITHUB_USER_NAME)
+- githubToken (DIBS_GITHUB_TOKEN)
+- githubRepository (DIBS_GITHUB_REPOSITORY)`)
 	flag.StringVar(&target, "target", runtime.GOOS, `The name of the target to use.
 This may also be set with the DIBS_TARGET env variable; a value of "*" runs all targets.`)
 	flag.StringVar(&platform, "platform", runtime.GOOS+"/"+runtime.GOARCH, `The identifier of the platform to use.
@@ -203,70 +1535,225 @@ This may also be set with the TARGETPLATFORM env variable; a value of "*" runs f
 		log.Fatal(err)
 	}
 
+	// Check whether the platforms which are built or run in Docker can be emulated before building any of them
+	if !skipEmulationCheck && (docker || buildImage || imageTests) {
+		var platformsToEmulate []string
+		for _, targetConfig := range configs.Targets {
+			if targetConfig.Name == target || target == "*" {
+				for _, platformConfig := range targetConfig.Platforms {
+					if platformConfig.Identifier == platform || platform == "*" {
+						platformsToEmulate = append(platformsToEmulate, platformConfig.Identifier)
+					}
+				}
+			}
+		}
+
+		if err := utils.CheckEmulation(utils.BinfmtMiscDir, platformsToEmulate); errors.Is(err, utils.ErrBinfmtUnavailable) {
+			// The Docker daemon might still be able to emulate the platforms, e.g. if it runs on another host
+			log.Println("Skipping the emulation check:", err)
+		} else if err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	stdoutChan, stderrChan := make(chan string), make(chan string)
 
+	// Resolve the credentials of all requested stages before running any of them
+	var credentialRequirements []utils.CredentialRequirement
+	for _, targetConfig := range configs.Targets {
+		if targetConfig.Name == target || target == "*" {
+			if pushChart && targetConfig.Helm.OCIRegistry != "" {
+				credentialRequirements = append(
+					credentialRequirements,
+					utils.CredentialRequirement{Names: []string{"ociUsername"}, Optional: true},
+					utils.CredentialRequirement{Names: []string{"ociPassword"}, Optional: true},
+				)
+			} else if pushChart && targetConfig.Helm.Repository.URL != "" {
+				credentialRequirements = append(
+					credentialRequirements,
+					utils.CredentialRequirement{Names: []string{"gitPassword"}, Optional: true},
+					utils.CredentialRequirement{Names: []string{"sshKeyPassword"}, Optional: true},
+				)
+
+				if targetConfig.Helm.Repository.GitHub.Repository != "" {
+					credentialRequirements = append(credentialRequirements, utils.CredentialRequirement{Names: []string{"githubToken"}})
+				}
+			} else if pushChart {
+				for _, name := range []string{"gitUserName", "gitUserEmail", "gitCommitMessage", "githubUserName", "githubToken", "githubRepositoryName", "githubRepositoryURL", "githubPagesURL"} {
+					credentialRequirements = append(credentialRequirements, utils.CredentialRequirement{Names: []string{name}})
+				}
+			}
+
+			if pushBinary {
+				for _, name := range []string{"githubUserName", "githubToken", "githubRepository"} {
+					credentialRequirements = append(credentialRequirements, utils.CredentialRequirement{Names: []string{name}})
+				}
+			}
+
+			if sign {
+				credentialRequirements = append(credentialRequirements, utils.CredentialRequirement{Names: []string{"signingKey", "signingGPGKeyID"}})
+			}
+		}
+	}
+
+	credentials, err := utils.NewCredentialManager(context, stdoutChan, stderrChan).ResolveAll(getCredentialSources(configs.Credentials), credentialRequirements)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	for _, targetConfig := range configs.Targets {
 		if targetConfig.Name == target || target == "*" {
 			if err := os.Setenv("DIBS_TARGET", target); err != nil {
 				log.Fatal(err)
 			}
 
+			imageValue := targetConfig.Helm.ImageValue
+			if imageValue == "" {
+				imageValue = "image"
+			}
+
 			if buildManifest {
 				var images []string
 
-				for _, platformConfig := range targetConfig.Platforms {
-					if platformConfig.Identifier == platform || platform == "*" {
-						images = append(images, platformConfig.Docker.Build.Tag)
+				for _, platformConfig := range targetConfig.Platforms {
+					if platformConfig.Identifier == platform || platform == "*" {
+						images = append(images, platformConfig.Docker.Build.Tag)
+					}
+				}
+
+				d := utils.NewDockerManager(context, stdoutChan, stderrChan)
+
+				go handleStdoutAndStderr(stdoutChan, stderrChan)
+
+				if err := d.BuildManifest(targetConfig.DockerManifest, images); err != nil {
+					log.Fatal(err)
+				}
+			}
+
+			if pushManifest {
+				d := utils.NewDockerManager(context, stdoutChan, stderrChan)
+
+				go handleStdoutAndStderr(stdoutChan, stderrChan)
+
+				if err := d.PushManifest(targetConfig.DockerManifest); err != nil {
+					log.Fatal(err)
+				}
+			}
+
+			if buildChart {
+				if err := os.MkdirAll(filepath.Join(context, targetConfig.Helm.Dist), 0777); err != nil {
+					log.Fatal(err)
+				}
+
+				version := ""
+				if targetConfig.Helm.StampVersion {
+					version, err = utils.GetLatestGitTag(filepath.Join(context, targetConfig.Helm.GitRepoRoot))
+					if err != nil {
+						log.Fatal(err)
+					}
+				}
+
+				var setValues []string
+				if targetConfig.Helm.InjectImage {
+					if targetConfig.DockerManifest == "" {
+						log.Fatal("dockerManifest must be set to inject the image into the Helm chart")
+					}
+
+					d := utils.NewDockerManager(context, stdoutChan, stderrChan)
+
+					go handleStdoutAndStderr(stdoutChan, stderrChan)
+
+					image := targetConfig.DockerManifest
+					if digest, err := d.GetManifestDigest(image); err == nil {
+						image += "@" + digest
+					} else {
+						log.Println("Could not get the digest of", image, "so only its tag will be injected:", err)
 					}
+
+					setValues = append(setValues, imageValue+"="+image)
 				}
 
-				d := utils.NewDockerManager(context, stdoutChan, stderrChan)
+				h := utils.NewHelmManager(context, stdoutChan, stderrChan)
 
 				go handleStdoutAndStderr(stdoutChan, stderrChan)
 
-				if err := d.BuildManifest(targetConfig.DockerManifest, images); err != nil {
+				if err := h.Build(filepath.Join(context, targetConfig.Helm.Src), filepath.Join(context, targetConfig.Helm.Dist), version, setValues); err != nil {
 					log.Fatal(err)
 				}
 			}
 
-			if pushManifest {
-				d := utils.NewDockerManager(context, stdoutChan, stderrChan)
+			if pushChart && targetConfig.Helm.OCIRegistry != "" {
+				h := utils.NewHelmManager(context, stdoutChan, stderrChan)
 
 				go handleStdoutAndStderr(stdoutChan, stderrChan)
 
-				if err := d.PushManifest(targetConfig.DockerManifest); err != nil {
+				if err := h.PushOCI(
+					filepath.Join(context, targetConfig.Helm.Dist),
+					targetConfig.Helm.OCIRegistry,
+					credentials.Get("ociUsername"),
+					credentials.Get("ociPassword"),
+					targetConfig.Helm.OCIPlainHTTP,
+				); err != nil {
 					log.Fatal(err)
 				}
-			}
+			} else if pushChart && targetConfig.Helm.Repository.URL != "" {
+				repository := targetConfig.Helm.Repository
 
-			if buildChart {
-				if err := os.MkdirAll(filepath.Join(context, targetConfig.Helm.Dist), 0777); err != nil {
+				sshKey := ""
+				if repository.SSHKey != "" {
+					sshKey = filepath.Join(context, repository.SSHKey)
+				}
+
+				auth, err := utils.GetGitAuth(repository.URL, repository.Username, credentials.Get("gitPassword"), sshKey, credentials.Get("sshKeyPassword"))
+				if err != nil {
 					log.Fatal(err)
 				}
 
+				var backend utils.ReleaseBackend
+				if repository.GitHub.Repository != "" {
+					backend = utils.NewGitHubReleaseBackend(utils.GitHubAPIURL, utils.GitHubUploadURL, repository.GitHub.Owner, repository.GitHub.Repository, credentials.Get("githubToken"))
+				}
+
+				commitMessage := repository.CommitMessage
+				if commitMessage == "" {
+					commitMessage = "chore: Update Helm charts"
+				}
+
 				h := utils.NewHelmManager(context, stdoutChan, stderrChan)
 
 				go handleStdoutAndStderr(stdoutChan, stderrChan)
 
-				if err := h.Build(filepath.Join(context, targetConfig.Helm.Src), filepath.Join(targetConfig.Helm.Dist)); err != nil {
+				if err := h.PushIndex(
+					backend,
+					utils.GitChartRepository{
+						URL:           repository.URL,
+						Branch:        repository.Branch,
+						Dir:           repository.Dir,
+						ChartsURL:     repository.ChartsURL,
+						Auth:          auth,
+						AuthorName:    repository.Author.Name,
+						AuthorEmail:   repository.Author.Email,
+						CommitMessage: commitMessage,
+					},
+					filepath.Join(context, targetConfig.Helm.Dist),
+					filepath.Join(os.TempDir(), "dibs-push-chart-repo"),
+				); err != nil {
 					log.Fatal(err)
 				}
-			}
-
-			if pushChart {
+			} else if pushChart {
 				h := utils.NewHelmManager(context, stdoutChan, stderrChan)
 
 				go handleStdoutAndStderr(stdoutChan, stderrChan)
 
 				if err := h.Push(
-					os.Getenv("DIBS_GIT_USER_NAME"),
-					os.Getenv("DIBS_GIT_USER_EMAIL"),
-					os.Getenv("DIBS_GIT_COMMIT_MESSAGE"),
-					os.Getenv("DIBS_GITHUB_USER_NAME"),
-					os.Getenv("DIBS_GITHUB_TOKEN"),
-					os.Getenv("DIBS_GITHUB_REPOSITORY_NAME"),
-					os.Getenv("DIBS_GITHUB_REPOSITORY_URL"),
-					os.Getenv("DIBS_GITHUB_PAGES_URL"),
+					credentials.Get("gitUserName"),
+					credentials.Get("gitUserEmail"),
+					credentials.Get("gitCommitMessage"),
+					credentials.Get("githubUserName"),
+					credentials.Get("githubToken"),
+					credentials.Get("githubRepositoryName"),
+					credentials.Get("githubRepositoryURL"),
+					credentials.Get("githubPagesURL"),
 					filepath.Join(context, targetConfig.Helm.Dist),
 					filepath.Join(os.TempDir(), "dibs-push-chart-repo"),
 				); err != nil {
@@ -274,15 +1761,76 @@ This may also be set with the TARGETPLATFORM env variable; a value of "*" runs f
 				}
 			}
 
+			if packageBinary {
+				if targetConfig.Release.Dist == "" {
+					log.Fatal("release.dist must be set to package binaries")
+				}
+
+				if err := utils.NewArchiveManager(context, stdoutChan, stderrChan).Clean(filepath.Join(context, targetConfig.Release.Dist)); err != nil {
+					log.Fatal(err)
+				}
+			}
+
+			// The release of the target is versioned with the latest tag of the repo of its first platform, which the release notes describe as well
+			releaseGitRepoRoot, version := "", ""
+			for _, platformConfig := range targetConfig.Platforms {
+				if platformConfig.Identifier == platform || platform == "*" {
+					releaseGitRepoRoot = filepath.Join(context, platformConfig.Paths.GitRepoRoot)
+
+					break
+				}
+			}
+
+			if releaseGitRepoRoot != "" && (packageBinary || buildReleaseNotes) {
+				latestTag, err := utils.GetLatestGitTag(releaseGitRepoRoot)
+				if err != nil {
+					log.Fatal(err)
+				}
+
+				version = latestTag
+			}
+
+			// The notes are pushed with the binaries of the platforms, so they are written first
+			if buildReleaseNotes && releaseGitRepoRoot != "" {
+				if targetConfig.Release.Notes == "" {
+					log.Fatal("release.notes must be set to build release notes")
+				}
+
+				c := utils.NewChangelogManager(context, stdoutChan, stderrChan)
+
+				notes, err := c.Generate(releaseGitRepoRoot, version)
+				if err != nil {
+					log.Fatal(err)
+				}
+
+				releaseNotes := filepath.Join(context, targetConfig.Release.Notes)
+				if err := os.MkdirAll(filepath.Join(releaseNotes, ".."), 0777); err != nil {
+					log.Fatal(err)
+				}
+
+				if err := ioutil.WriteFile(releaseNotes, []byte(notes), 0666); err != nil {
+					log.Fatal(err)
+				}
+
+				log.Println("Wrote", releaseNotes)
+			}
+
 			for _, platformConfig := range targetConfig.Platforms {
 				if platformConfig.Identifier == platform || platform == "*" {
 					if err := os.Setenv("TARGETPLATFORM", platformConfig.Identifier); err != nil {
 						log.Fatal(err)
 					}
 
-					if dev {
-						go handleStdoutAndStderr(stdoutChan, stderrChan)
+					// Commands in Docker are emulated by the binfmt_misc handlers
+					emulator := ""
+					if emulate && !docker {
+						emulator, err = setupEmulator(platformConfig.Identifier)
+						if err != nil {
+							log.Fatal(err)
+						}
+					}
 
+					if dev {
 						allCommands := []string{
 							platformConfig.Commands.GenerateSources,
 							platformConfig.Commands.Build,
@@ -290,9 +1838,12 @@ This may also be set with the TARGETPLATFORM env variable; a value of "*" runs f
 							platformConfig.Commands.IntegrationTests,
 							platformConfig.Commands.Start,
 						}
-						var commandsToRun []string
-						for _, command := range allCommands {
-							if skipTests && command == platformConfig.Commands.UnitTests || command == platformConfig.Commands.IntegrationTests {
+						var (
+							commandsToRun []string
+							stagesToRun   []string
+						)
+						for i, command := range allCommands {
+							if command == "" {
 								continue
 							}
 
@@ -300,59 +1851,407 @@ This may also be set with the TARGETPLATFORM env variable; a value of "*" runs f
 								continue
 							}
 
+							if devStages[i] == "unitTests" || devStages[i] == "integrationTests" {
+								command = emulateExecLine(emulator, context, command)
+							}
+
 							commandsToRun = append(commandsToRun, command)
+							stagesToRun = append(stagesToRun, devStages[i])
+						}
+
+						var stageRules []utils.StageRule
+						for _, rule := range platformConfig.Watcher.Stages {
+							if !isDevStage(rule.Stage) {
+								log.Fatal("unknown stage ", rule.Stage, " in the watcher's stages, use one of ", strings.Join(devStages, ", "))
+							}
+
+							stageRules = append(stageRules, utils.StageRule{Pattern: rule.Pattern, Stage: rule.Stage})
+						}
+
+						changedFilesList := newChangedFilesList()
+						defer os.Remove(changedFilesList)
+
+						// The start command debugs the platform's asset by default
+						startDebug := platformConfig.Debug
+						if startDebug != nil && startDebug.Asset == "" {
+							startDebug.Asset = platformConfig.Paths.AssetOut
+						}
+
+						services, err := getServices(serviceConfig{
+							Command: platformConfig.Commands.Start,
+							Probes:  platformConfig.Probes,
+							Restart: platformConfig.Restart,
+							Debug:   startDebug,
+						}, platformConfig.Services)
+						if err != nil {
+							log.Fatal(err)
+						}
+						for i, service := range services {
+							services[i].Command = emulateExecLine(emulator, context, service.Command)
+						}
+
+						// The start command is run as a service, and all services are restarted by the "start" stage
+						if len(stagesToRun) > 0 && stagesToRun[len(stagesToRun)-1] == "start" {
+							commandsToRun, stagesToRun = commandsToRun[:len(commandsToRun)-1], stagesToRun[:len(stagesToRun)-1]
+						}
+						for range services {
+							stagesToRun = append(stagesToRun, "start")
+						}
+
+						// The commands are run in a dev container which keeps running while the flow is restarted
+						var (
+							devContainerID string
+							devConfig      = platformConfig.Docker.Dev
+						)
+						if docker {
+							if devConfig.Tag == "" {
+								log.Fatal("-dev with -docker requires the platform's docker.dev image")
+							}
+							if devConfig.Workdir == "" {
+								devConfig.Workdir = utils.DefaultDevWorkdir
+							}
+							if devConfig.Sync == "" {
+								devConfig.Sync = utils.DevSyncMount
+							}
+							if devConfig.Sync != utils.DevSyncMount && devConfig.Sync != utils.DevSyncCopy {
+								log.Fatal("unknown docker.dev.sync ", devConfig.Sync, ", use ", utils.DevSyncMount, " or ", utils.DevSyncCopy)
+							}
+
+							// The debuggers' ports can't be managed in the dev container, so the commands have to use DIBS_DEBUG instead
+							for i, service := range services {
+								if service.Debugger == nil {
+									continue
+								}
+
+								if debugFlag || os.Getenv("DIBS_DEBUG") == "true" {
+									log.Fatal("debuggers are not supported with -docker, as their ports can't be managed in the dev container; use DIBS_DEBUG in the commands instead")
+								}
+
+								services[i].Debugger = nil
+							}
+
+							setupStdoutChan, setupStderrChan := make(chan string), make(chan string)
+							go handleStdoutAndStderr(setupStdoutChan, setupStderrChan)
+
+							d := utils.NewDockerManager(context, setupStdoutChan, setupStderrChan)
+
+							if err := d.Build(filepath.Join(context, devConfig.File), filepath.Join(context, devConfig.Context), devConfig.Tag); err != nil {
+								log.Fatal(err)
+							}
+
+							devContainerID, err = d.StartDevContainer(devConfig.Tag, context, devConfig.Workdir, devConfig.Sync == utils.DevSyncMount, devConfig.Ports)
+							if err != nil {
+								log.Fatal(err)
+							}
+							defer d.RemoveContainer(devContainerID)
+
+							log.Println("Started dev container", devContainerID)
+
+							if devConfig.Sync == utils.DevSyncCopy {
+								if err := d.CopyToContainer(devContainerID, context+string(filepath.Separator)+".", devConfig.Workdir); err != nil {
+									log.Fatal(err)
+								}
+							}
+
+							if err := d.CopyToContainer(devContainerID, changedFilesList, utils.DevChangedFilesList); err != nil {
+								log.Fatal(err)
+							}
+
+							for i, command := range commandsToRun {
+								commandsToRun[i] = utils.GetDevExecLine(devContainerID, devConfig.Workdir, stagesToRun[i], command)
+							}
+
+							for i, service := range services {
+								name := service.Name
+								if name == "" {
+									name = "start"
+								}
+
+								services[i].Command = utils.GetDevExecLine(devContainerID, devConfig.Workdir, "service-"+name, service.Command)
+							}
+						}
+
+						commandFlow, err := utils.NewServiceCommandFlow(commandsToRun, services, context, stdoutChan, stderrChan)
+						if err != nil {
+							log.Fatal(err)
+						}
+
+						var (
+							// restartLock serializes the restarts by the path watcher and the console
+							restartLock     sync.Mutex
+							changedFilesEnv = getChangedFilesEnv(nil, changedFilesList)
+							debug           = debugFlag || os.Getenv("DIBS_DEBUG") == "true"
+						)
+						getEnv := func() []string {
+							return append(append([]string{}, changedFilesEnv...), "DIBS_DEBUG="+strconv.FormatBool(debug))
+						}
+
+						// The test stages are skipped instead of being left out, so that they can be run from the console
+						skippedTests := map[string]bool{}
+						setTestSkipped := func(testStage string, skipped bool) {
+							skippedTests[testStage] = skipped
+
+							for i, stage := range stagesToRun {
+								if stage == testStage {
+									commandFlow.SetSkipped(i, skipped)
+								}
+							}
+						}
+						setTestSkipped("unitTests", skipTests || skipUnitTests)
+						setTestSkipped("integrationTests", skipTests || skipIntegrationTests)
+
+						// Failing tests are reported, but don't take down the app
+						for i, stage := range stagesToRun {
+							if isTestStage(stage) {
+								commandFlow.SetAllowFailure(i, true)
+							}
 						}
 
-						commandFlow := utils.NewCommandFlow(commandsToRun, context, stdoutChan, stderrChan)
+						commandFlow.SetEnv(getEnv())
+						commandFlow.SetDebug(debug)
+
+						// restartFrom must be called with the restartLock held; it returns the StageError of a failed stage after logging it
+						restartFrom := func(stage int, reason string) error {
+							log.Println("Restarting from stage", stagesToRun[stage], reason)
+
+							if err := commandFlow.RestartFrom(stage, getEnv()); err != nil {
+								switch err := err.(type) {
+								case *utils.StageFailuresError:
+									logStageFailures(err, stagesToRun, ", but the app has been restarted anyway")
+
+									return nil
+								case *utils.StageError:
+									// Keep the app running, so that e.g. a compile error doesn't take down the dev server
+									log.Println("Not restarting the app, as stage", stagesToRun[err.Stage], "failed:", err.Err)
+
+									return err
+								}
+
+								log.Fatal(err)
+							}
+
+							return nil
+						}
+
+						getStatus := func() []utils.DevStageStatus {
+							var statuses []utils.DevStageStatus
+							for i, status := range commandFlow.GetStatus() {
+								statuses = append(statuses, utils.DevStageStatus{Stage: stagesToRun[i], CommandStatus: status})
+							}
+
+							return statuses
+						}
 
 						interrupt := make(chan os.Signal, 2)
-						signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
-						go func() {
-							<-interrupt
 
-							// Allow manually killing the process
-							go func() {
-								<-interrupt
+						var (
+							console *utils.DevConsole
+							devAPI  *utils.DevAPIServer
+						)
+						console = utils.NewDevConsole(os.Stdin, os.Stdout, []utils.ConsoleKey{
+							{Key: 'r', Description: "Restart the flow from the first stage", Handler: func() {
+								restartLock.Lock()
+								defer restartLock.Unlock()
+
+								_ = restartFrom(0, "because a restart has been requested")
+							}},
+							{Key: 't', Description: "Rerun the test stages", Handler: func() {
+								restartLock.Lock()
+								defer restartLock.Unlock()
+
+								for i, stage := range stagesToRun {
+									if !isTestStage(stage) {
+										continue
+									}
+
+									log.Println("Running stage", stage)
 
-								os.Exit(1)
-							}()
+									if err := commandFlow.RunStages(i, i+1, getEnv()); err != nil {
+										if failuresErr, ok := err.(*utils.StageFailuresError); ok {
+											logStageFailures(failuresErr, stagesToRun, "")
 
+											continue
+										}
+
+										log.Println("Stage", stage, "failed:", err)
+
+										return
+									}
+								}
+							}},
+							{Key: 's', Description: "Toggle skipping all test stages (-skipTests)", Handler: func() {
+								restartLock.Lock()
+								defer restartLock.Unlock()
+
+								skipped := !(skippedTests["unitTests"] && skippedTests["integrationTests"])
+								setTestSkipped("unitTests", skipped)
+								setTestSkipped("integrationTests", skipped)
+
+								log.Println("Skipping tests:", skipped)
+							}},
+							{Key: 'u', Description: "Toggle skipping the unit tests (-skipUnitTests)", Handler: func() {
+								restartLock.Lock()
+								defer restartLock.Unlock()
+
+								setTestSkipped("unitTests", !skippedTests["unitTests"])
+
+								log.Println("Skipping unit tests:", skippedTests["unitTests"])
+							}},
+							{Key: 'n', Description: "Toggle skipping the integration tests (-skipIntegrationTests)", Handler: func() {
+								restartLock.Lock()
+								defer restartLock.Unlock()
+
+								setTestSkipped("integrationTests", !skippedTests["integrationTests"])
+
+								log.Println("Skipping integration tests:", skippedTests["integrationTests"])
+							}},
+							{Key: 'd', Description: "Toggle debugging (-debug and DIBS_DEBUG) and restart the services", Handler: func() {
+								restartLock.Lock()
+								defer restartLock.Unlock()
+
+								debug = !debug
+								commandFlow.SetDebug(debug)
+
+								_ = restartFrom(len(stagesToRun)-1, "with DIBS_DEBUG="+strconv.FormatBool(debug))
+							}},
+							{Key: 'c', Description: "Clear the screen", Handler: func() {
+								fmt.Print("\033[H\033[2J")
+							}},
+							{Key: 'i', Description: "Show the status of the stages and services", Handler: func() {
+								log.Println("Status (DIBS_DEBUG=" + strconv.FormatBool(debug) + "):")
+
+								for _, status := range getStatus() {
+									name := status.Stage
+									if status.Service != "" {
+										name += " (" + status.Service + ")"
+									}
+
+									state := status.ExitStatus
+									switch {
+									case status.Skipped:
+										state = "skipped"
+									case status.Running:
+										state = "running"
+									}
+									if status.Debugging {
+										state += " under the debugger"
+									}
+									if status.IsService && status.Retries > 0 {
+										state += ", restarted " + strconv.Itoa(status.Retries) + " times"
+									}
+
+									log.Println("  "+name+":", state)
+								}
+							}},
+							{Key: 'h', Description: "Show this help", Handler: func() {
+								if err := console.PrintHelp(); err != nil {
+									log.Println("Could not print the help:", err)
+								}
+							}},
+							{Key: 'q', Description: "Stop the flow and quit (like Ctrl-C)", Handler: func() {
+								interrupt <- os.Interrupt
+							}},
+						})
+						handleInterrupts(interrupt, func() {
 							log.Println("Gracefully stopping command flow (this might take a few seconds)")
 
+							if err := console.Stop(); err != nil {
+								log.Println("Could not restore the terminal:", err)
+							}
+
+							if devAPI != nil {
+								if err := devAPI.Stop(); err != nil {
+									log.Println("Could not stop the dev API:", err)
+								}
+							}
+
 							if err := commandFlow.Stop(); err != nil {
 								log.Fatal(err)
 							}
 
-							os.Exit(0) // The path watcher is blocking
-						}()
+							if devContainerID != "" {
+								if err := utils.NewDockerManager(context, stdoutChan, stderrChan).RemoveContainer(devContainerID); err != nil {
+									log.Println("Could not remove the dev container:", err)
+								}
+							}
 
-						if err := commandFlow.Start(); err != nil {
-							log.Fatal(err)
-						}
+							_ = os.Remove(changedFilesList)
+						})
 
-						eventChan := make(chan string)
+						if devAPIAddress != "" {
+							devAPI = utils.NewDevAPIServer(devAPIAddress, getStatus, func(stage string) error {
+								index := 0
+								if stage != "" {
+									index = -1
+									for i, stageToRun := range stagesToRun {
+										if stageToRun == stage {
+											index = i
 
-						pathWatcher := utils.NewPathWatcher(filepath.Join(context, platformConfig.Paths.Watch), filepath.Join(context, platformConfig.Paths.Include), eventChan)
+											break
+										}
+									}
 
-						go func() {
-							for {
-								select {
-								case <-eventChan:
-									if err := commandFlow.Restart(); err != nil {
-										log.Fatal(err)
+									if index == -1 {
+										return fmt.Errorf("%w %v, use one of %v", utils.ErrUnknownStage, stage, strings.Join(stagesToRun, ", "))
 									}
 								}
+
+								restartLock.Lock()
+								defer restartLock.Unlock()
+
+								return restartFrom(index, "because a restart has been requested over the dev API")
+							}, func() {
+								interrupt <- os.Interrupt
+							})
+
+							if err := devAPI.Start(); err != nil {
+								log.Fatal(err)
 							}
-						}()
+
+							log.Println("Serving the dev API on", devAPI.Addr())
+						}
+
+						go handleDevStdoutAndStderr(stdoutChan, stderrChan, devAPI)
+
+						if err := commandFlow.Start(); err != nil {
+							failuresErr, ok := err.(*utils.StageFailuresError)
+							if !ok {
+								log.Fatal(err)
+							}
+
+							logStageFailures(failuresErr, stagesToRun, ", but the app has been started anyway")
+						}
+
+						// Without a terminal, the flow can only be controlled by changing files and signals
+						if err := console.Start(); err == nil {
+							if err := console.PrintHelp(); err != nil {
+								log.Fatal(err)
+							}
+
+							defer console.Stop()
+						} else if err != utils.ErrNotInteractive {
+							log.Println("Could not enable the keyboard controls:", err)
+						}
 
 						defer func() {
 							if err := commandFlow.Stop(); err != nil {
 								log.Fatal(err)
 							}
 						}()
-						if err := pathWatcher.Start(); err != nil {
-							log.Fatal(err)
-						}
+
+						watchPaths(context, platformConfig.Paths.Watch, platformConfig.Paths.Include, platformConfig.Watcher, func(changedFiles, relativeChangedFiles []string) {
+							restartLock.Lock()
+							defer restartLock.Unlock()
+
+							writeChangedFilesList(changedFilesList, relativeChangedFiles)
+							changedFilesEnv = getChangedFilesEnv(relativeChangedFiles, changedFilesList)
+
+							if devContainerID != "" {
+								syncDevContainer(utils.NewDockerManager(context, stdoutChan, stderrChan), devContainerID, devConfig, context, changedFilesList, changedFiles)
+							}
+
+							_ = restartFrom(utils.GetRestartStage(context, changedFiles, stageRules, stagesToRun), "because of changes to "+strings.Join(relativeChangedFiles, ", "))
+						})
 					}
 
 					if generateSources {
@@ -395,7 +2294,7 @@ This may also be set with the TARGETPLATFORM env variable; a value of "*" runs f
 						if docker {
 							buildAndRunDockerContainer("", context, platformConfig.Docker.UnitTests, false, stdoutChan, stderrChan)
 						} else {
-							runCommandWithLog(platformConfig.Commands.UnitTests, context, stdoutChan, stderrChan)
+							runCommandWithLog(emulateExecLine(emulator, context, platformConfig.Commands.UnitTests), context, stdoutChan, stderrChan)
 						}
 					}
 
@@ -403,7 +2302,7 @@ This may also be set with the TARGETPLATFORM env variable; a value of "*" runs f
 						if docker {
 							buildAndRunDockerContainer("", context, platformConfig.Docker.IntegrationTests, false, stdoutChan, stderrChan)
 						} else {
-							runCommandWithLog(platformConfig.Commands.IntegrationTests, context, stdoutChan, stderrChan)
+							runCommandWithLog(emulateExecLine(emulator, context, platformConfig.Commands.IntegrationTests), context, stdoutChan, stderrChan)
 						}
 					}
 
@@ -419,6 +2318,21 @@ This may also be set with the TARGETPLATFORM env variable; a value of "*" runs f
 						}
 					}
 
+					if verifyChart {
+						var valuesFiles []string
+						for _, valuesFile := range targetConfig.Helm.ValuesFiles {
+							valuesFiles = append(valuesFiles, filepath.Join(context, valuesFile))
+						}
+
+						h := utils.NewHelmManager(context, stdoutChan, stderrChan)
+
+						go handleStdoutAndStderr(stdoutChan, stderrChan)
+
+						if err := h.Verify(filepath.Join(context, targetConfig.Helm.Src), valuesFiles, []string{imageValue + "=" + platformConfig.Docker.Build.Tag}); err != nil {
+							log.Fatal(err)
+						}
+					}
+
 					if publish {
 						if docker {
 							buildAndRunDockerContainer("", context, platformConfig.Docker.Publish, false, stdoutChan, stderrChan)
@@ -437,23 +2351,146 @@ This may also be set with the TARGETPLATFORM env variable; a value of "*" runs f
 						}
 					}
 
-					if pushBinary {
-						h := utils.NewBinaryManager(context, stdoutChan, stderrChan)
+					if packageBinary {
+						name := targetConfig.Release.Name
+						if name == "" {
+							name = targetConfig.Name
+						}
+
+						var extraFiles []string
+						for _, file := range targetConfig.Release.Files {
+							extraFiles = append(extraFiles, filepath.Join(context, file))
+						}
 
-						go handleStdoutAndStderr(stdoutChan, stderrChan)
+						a := utils.NewArchiveManager(context, stdoutChan, stderrChan)
 
-						if err := h.Push(
-							os.Getenv("DIBS_GITHUB_USER_NAME"),
-							os.Getenv("DIBS_GITHUB_TOKEN"),
-							os.Getenv("DIBS_GITHUB_REPOSITORY"),
-							filepath.Join(context, platformConfig.Paths.GitRepoRoot),
+						archive, err := a.Package(
 							filepath.Join(context, platformConfig.Paths.AssetOut),
-						); err != nil {
+							extraFiles,
+							filepath.Join(context, targetConfig.Release.Dist),
+							targetConfig.Release.Format,
+							targetConfig.Release.Template,
+							utils.NewArchiveNameData(name, version, platformConfig.Identifier),
+						)
+						if err != nil {
 							log.Fatal(err)
 						}
+
+						log.Println("Packaged", archive)
+
+						if provenance {
+							absoluteConfigFilePath, err := filepath.Abs(configFilePath)
+							if err != nil {
+								log.Fatal(err)
+							}
+
+							filters, err := getPathFilters(context, platformConfig.Paths.Watch, platformConfig.Paths.Include, platformConfig.Watcher)
+							if err != nil {
+								log.Fatal(err)
+							}
+
+							inputs, err := utils.GetInputFiles(filters)
+							if err != nil {
+								log.Fatal(err)
+							}
+
+							p := utils.NewProvenanceManager(context, stdoutChan, stderrChan)
+
+							archiveProvenance, err := p.Generate(
+								[]string{archive},
+								absoluteConfigFilePath,
+								filepath.Join(context, platformConfig.Paths.GitRepoRoot),
+								targetConfig.Name,
+								platformConfig.Identifier,
+								[]utils.ProvenanceCommand{
+									{Stage: "generateSources", Command: platformConfig.Commands.GenerateSources},
+									{Stage: "build", Command: platformConfig.Commands.Build},
+								},
+								inputs,
+							)
+							if err != nil {
+								log.Fatal(err)
+							}
+
+							if err := p.Write(archiveProvenance, archive+utils.ProvenanceExtension); err != nil {
+								log.Fatal(err)
+							}
+
+							log.Println("Wrote", archive+utils.ProvenanceExtension)
+						}
+					}
+
+					// The release dist contains the assets of all platforms, so it is pushed once after they have been packaged and signed
+					if pushBinary && targetConfig.Release.Dist == "" {
+						pushAssets(
+							context,
+							filepath.Join(context, platformConfig.Paths.GitRepoRoot),
+							filepath.Join(context, platformConfig.Paths.AssetOut),
+							targetConfig.Release.Notes,
+							credentials,
+							stdoutChan,
+							stderrChan,
+						)
+					}
+				}
+			}
+
+			if packageBinary {
+				a := utils.NewArchiveManager(context, stdoutChan, stderrChan)
+
+				checksums, err := a.WriteChecksums(filepath.Join(context, targetConfig.Release.Dist))
+				if err != nil {
+					log.Fatal(err)
+				}
+
+				log.Println("Wrote", checksums)
+			}
+
+			if sign {
+				files, err := utils.GetSignableFiles(filepath.Join(context, targetConfig.Release.Dist))
+				if err != nil {
+					log.Fatal(err)
+				}
+
+				if targetConfig.Helm.Dist != "" {
+					charts, err := utils.GetSignableCharts(filepath.Join(context, targetConfig.Helm.Dist))
+					if err != nil {
+						log.Fatal(err)
+					}
+
+					files = append(files, charts...)
+				}
+
+				s := utils.NewSignatureManager(context, stdoutChan, stderrChan)
+
+				go handleStdoutAndStderr(stdoutChan, stderrChan)
+
+				for _, file := range files {
+					var signature string
+					if signingKey := credentials.Get("signingKey"); signingKey != "" {
+						signature, err = s.Sign(signingKey, file)
+					} else {
+						signature, err = s.SignGPG(credentials.Get("signingGPGKeyID"), file)
+					}
+					if err != nil {
+						log.Fatal(err)
 					}
+
+					log.Println("Wrote", signature)
 				}
 			}
+
+			if pushBinary && targetConfig.Release.Dist != "" && releaseGitRepoRoot != "" {
+				pushAssets(
+					context,
+					releaseGitRepoRoot,
+					filepath.Join(context, targetConfig.Release.Dist),
+					targetConfig.Release.Notes,
+					credentials,
+					stdoutChan,
+					stderrChan,
+				)
+			}
 		}
 	}
 }
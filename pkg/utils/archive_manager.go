@@ -0,0 +1,303 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+const (
+	// ArchiveFormatTarGz is the format for .tar.gz archives
+	ArchiveFormatTarGz = "tar.gz"
+	// ArchiveFormatZip is the format for .zip archives
+	ArchiveFormatZip = "zip"
+	// DefaultArchiveNameTemplate is the template used to name archives if none is set
+	DefaultArchiveNameTemplate = "{{.Name}}-{{.Version}}-{{.OS}}-{{.Arch}}"
+	// ChecksumsFileName is the name of the file which contains the checksums of all archives
+	ChecksumsFileName = "SHA256SUMS"
+)
+
+// ArchiveNameData is the data which can be used in an archive name template
+type ArchiveNameData struct {
+	Name    string
+	Version string
+	OS      string
+	Arch    string
+	Variant string
+}
+
+// NewArchiveNameData creates new ArchiveNameData from a platform identifier such as `linux/arm/v7`
+func NewArchiveNameData(name, version, platform string) ArchiveNameData {
+	data := ArchiveNameData{
+		Name:    name,
+		Version: version,
+	}
+
+	parts := strings.Split(platform, "/")
+	if len(parts) > 0 {
+		data.OS = parts[0]
+	}
+	if len(parts) > 1 {
+		data.Arch = parts[1]
+	}
+	if len(parts) > 2 {
+		data.Variant = parts[2]
+	}
+
+	return data
+}
+
+// ArchiveManager manages release archives
+type ArchiveManager struct {
+	dir                    string
+	stdoutChan, stderrChan chan string
+}
+
+// NewArchiveManager creates a new ArchiveManager
+func NewArchiveManager(dir string, stdoutChan, stderrChan chan string) *ArchiveManager {
+	return &ArchiveManager{
+		dir:        dir,
+		stdoutChan: stdoutChan,
+		stderrChan: stderrChan,
+	}
+}
+
+func getArchiveName(nameTemplate, format string, data ArchiveNameData) (string, error) {
+	if nameTemplate == "" {
+		nameTemplate = DefaultArchiveNameTemplate
+	}
+
+	tmpl, err := template.New("archiveName").Option("missingkey=error").Parse(nameTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	var name bytes.Buffer
+	if err := tmpl.Execute(&name, data); err != nil {
+		return "", err
+	}
+
+	return name.String() + "." + format, nil
+}
+
+// Package bundles an asset and extra files into an archive in dist and returns the archive's path
+func (a *ArchiveManager) Package(assetOut string, extraFiles []string, dist, format, nameTemplate string, data ArchiveNameData) (string, error) {
+	if format == "" {
+		format = ArchiveFormatTarGz
+	}
+
+	if format != ArchiveFormatTarGz && format != ArchiveFormatZip {
+		return "", errors.New("unsupported archive format " + format + ", use " + ArchiveFormatTarGz + " or " + ArchiveFormatZip)
+	}
+
+	name, err := getArchiveName(nameTemplate, format, data)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(dist, 0777); err != nil {
+		return "", err
+	}
+
+	archivePath := filepath.Join(dist, name)
+
+	out, err := os.Create(archivePath)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	files := append([]string{assetOut}, extraFiles...)
+
+	if format == ArchiveFormatZip {
+		err = writeZipArchive(out, files)
+	} else {
+		err = writeTarGzArchive(out, files)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return archivePath, out.Close()
+}
+
+func writeTarGzArchive(out io.Writer, files []string) error {
+	gzipWriter := gzip.NewWriter(out)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.Base(file)
+
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if err := copyFileTo(tarWriter, file); err != nil {
+			return err
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+
+	return gzipWriter.Close()
+}
+
+func writeZipArchive(out io.Writer, files []string) error {
+	zipWriter := zip.NewWriter(out)
+
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.Base(file)
+		header.Method = zip.Deflate
+
+		writer, err := zipWriter.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		if err := copyFileTo(writer, file); err != nil {
+			return err
+		}
+	}
+
+	return zipWriter.Close()
+}
+
+func copyFileTo(writer io.Writer, file string) error {
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	_, err = io.Copy(writer, in)
+
+	return err
+}
+
+func getSHA256Sum(file string) (string, error) {
+	in, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, in); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Clean removes the archives, checksums and provenance files in dist and their signatures, so that those of earlier releases are not checksummed, signed or pushed again
+func (a *ArchiveManager) Clean(dist string) error {
+	files, err := GetSignableFiles(dist)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range append(files, GetSignatures(files)...) {
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteChecksums writes the SHA256 checksums of all archives in dist into a `SHA256SUMS` file and returns its path
+func (a *ArchiveManager) WriteChecksums(dist string) (string, error) {
+	var archives []string
+	for _, format := range []string{ArchiveFormatTarGz, ArchiveFormatZip} {
+		matches, err := filepath.Glob(filepath.Join(dist, "*."+format))
+		if err != nil {
+			return "", err
+		}
+
+		archives = append(archives, matches...)
+	}
+	sort.Strings(archives)
+
+	var checksums bytes.Buffer
+	for _, archive := range archives {
+		sum, err := getSHA256Sum(archive)
+		if err != nil {
+			return "", err
+		}
+
+		// Same format as `sha256sum`, so that the file can be checked with `sha256sum -c`
+		checksums.WriteString(sum + "  " + filepath.Base(archive) + "\n")
+	}
+
+	checksumsPath := filepath.Join(dist, ChecksumsFileName)
+
+	return checksumsPath, ioutil.WriteFile(checksumsPath, checksums.Bytes(), 0666)
+}
+
+// VerifyChecksums checks all archives listed in the `SHA256SUMS` file in dist against their checksums
+func (a *ArchiveManager) VerifyChecksums(dist string) error {
+	checksums, err := ioutil.ReadFile(filepath.Join(dist, ChecksumsFileName))
+	if err != nil {
+		return err
+	}
+
+	verified := 0
+	for _, line := range strings.Split(strings.TrimSpace(string(checksums)), "\n") {
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return errors.New("invalid line in " + ChecksumsFileName + ": " + line)
+		}
+
+		sum, err := getSHA256Sum(filepath.Join(dist, fields[1]))
+		if err != nil {
+			return err
+		}
+
+		if sum != fields[0] {
+			return errors.New("checksum mismatch for " + fields[1])
+		}
+
+		verified++
+	}
+
+	if verified == 0 {
+		return errors.New(ChecksumsFileName + " does not list any files")
+	}
+
+	return nil
+}
@@ -0,0 +1,264 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var (
+	testArchiveDir      = filepath.Join(os.TempDir(), "test-archive-dir")
+	testArchiveAsset    = filepath.Join(testArchiveDir, "test-app-linux-amd64")
+	testArchiveReadme   = filepath.Join(testArchiveDir, "README.md")
+	testArchiveDist     = filepath.Join(testArchiveDir, "release")
+	testArchiveNameData = NewArchiveNameData("test-app", "v0.0.1", "linux/amd64")
+)
+
+func setupArchiveTest(t *testing.T) {
+	if err := os.RemoveAll(testArchiveDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(testArchiveDir, 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(testArchiveAsset, []byte("binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(testArchiveReadme, []byte("# test-app"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreateArchiveManager(t *testing.T) {
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+
+	a := NewArchiveManager(testContext, stdoutChan, stderrChan)
+
+	if a == nil {
+		t.Error("New archive manager is nil")
+	}
+
+	if a.dir != testContext {
+		t.Error("dir not set correctly")
+	}
+
+	if a.stdoutChan != stdoutChan {
+		t.Error("stdoutChan not set correctly")
+	}
+
+	if a.stderrChan != stderrChan {
+		t.Error("stderrChan not correctly")
+	}
+}
+
+func TestNewArchiveNameData(t *testing.T) {
+	data := NewArchiveNameData("test-app", "v0.0.1", "linux/arm/v7")
+
+	if data.OS != "linux" || data.Arch != "arm" || data.Variant != "v7" {
+		t.Error("platform not parsed correctly", data)
+	}
+}
+
+func TestPackageTarGzArchiveManager(t *testing.T) {
+	setupArchiveTest(t)
+
+	a := NewArchiveManager(testArchiveDir, make(chan string), make(chan string))
+
+	archive, err := a.Package(testArchiveAsset, []string{testArchiveReadme}, testArchiveDist, ArchiveFormatTarGz, "", testArchiveNameData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if filepath.Base(archive) != "test-app-v0.0.1-linux-amd64.tar.gz" {
+		t.Error("archive not named correctly", archive)
+	}
+
+	in, err := os.Open(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+
+	gzipReader, err := gzip.NewReader(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err != nil {
+			break
+		}
+
+		names = append(names, header.Name)
+	}
+
+	if strings.Join(names, ",") != "test-app-linux-amd64,README.md" {
+		t.Error("archive does not contain the expected files", names)
+	}
+}
+
+func TestPackageZipArchiveManager(t *testing.T) {
+	setupArchiveTest(t)
+
+	a := NewArchiveManager(testArchiveDir, make(chan string), make(chan string))
+
+	archive, err := a.Package(testArchiveAsset, []string{testArchiveReadme}, testArchiveDist, ArchiveFormatZip, "{{.Name}}_{{.OS}}_{{.Arch}}", testArchiveNameData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if filepath.Base(archive) != "test-app_linux_amd64.zip" {
+		t.Error("archive not named correctly", archive)
+	}
+
+	zipReader, err := zip.OpenReader(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zipReader.Close()
+
+	if len(zipReader.File) != 2 || zipReader.File[0].Name != "test-app-linux-amd64" {
+		t.Error("archive does not contain the expected files")
+	}
+}
+
+func TestPackageUnsupportedFormatArchiveManager(t *testing.T) {
+	setupArchiveTest(t)
+
+	a := NewArchiveManager(testArchiveDir, make(chan string), make(chan string))
+
+	if _, err := a.Package(testArchiveAsset, nil, testArchiveDist, "rar", "", testArchiveNameData); err == nil {
+		t.Error("unsupported format did not return an error")
+	}
+}
+
+func TestWriteChecksumsArchiveManager(t *testing.T) {
+	setupArchiveTest(t)
+
+	a := NewArchiveManager(testArchiveDir, make(chan string), make(chan string))
+
+	for _, platform := range []string{"linux/amd64", "linux/arm64"} {
+		if _, err := a.Package(testArchiveAsset, nil, testArchiveDist, ArchiveFormatTarGz, "", NewArchiveNameData("test-app", "v0.0.1", platform)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checksumsPath, err := a.WriteChecksums(testArchiveDist)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checksums, err := ioutil.ReadFile(checksumsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(checksums)), "\n")
+	if len(lines) != 2 {
+		t.Fatal("checksums file does not contain all archives", lines)
+	}
+
+	if !strings.HasSuffix(lines[0], "  test-app-v0.0.1-linux-amd64.tar.gz") || len(strings.Fields(lines[0])[0]) != 64 {
+		t.Error("checksums file has an unexpected format", lines[0])
+	}
+}
+
+func TestCleanArchiveManager(t *testing.T) {
+	setupArchiveTest(t)
+
+	a := NewArchiveManager(testArchiveDir, make(chan string), make(chan string))
+
+	stale, err := a.Package(testArchiveAsset, nil, testArchiveDist, ArchiveFormatTarGz, "", NewArchiveNameData("test-app", "v0.0.0", "linux/amd64"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keep := filepath.Join(testArchiveDist, "README.md")
+	for _, file := range []string{stale + SignatureExtension, filepath.Join(testArchiveDist, ChecksumsFileName), keep} {
+		if err := ioutil.WriteFile(file, []byte("test"), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := a.Clean(testArchiveDist); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range []string{stale, stale + SignatureExtension, filepath.Join(testArchiveDist, ChecksumsFileName)} {
+		if _, err := os.Stat(file); err == nil {
+			t.Errorf("%v has not been removed", file)
+		}
+	}
+
+	if _, err := os.Stat(keep); err != nil {
+		t.Error("other files have been removed:", err)
+	}
+
+	if _, err := a.Package(testArchiveAsset, nil, testArchiveDist, ArchiveFormatTarGz, "", testArchiveNameData); err != nil {
+		t.Fatal(err)
+	}
+
+	checksumsPath, err := a.WriteChecksums(testArchiveDist)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checksums, err := ioutil.ReadFile(checksumsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(checksums), filepath.Base(stale)) {
+		t.Error("checksums file contains a stale archive", string(checksums))
+	}
+}
+
+func TestVerifyChecksumsArchiveManager(t *testing.T) {
+	setupArchiveTest(t)
+
+	a := NewArchiveManager(testArchiveDir, make(chan string), make(chan string))
+
+	archive, err := a.Package(testArchiveAsset, nil, testArchiveDist, ArchiveFormatTarGz, "", testArchiveNameData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.VerifyChecksums(testArchiveDist); err == nil {
+		t.Error("missing checksums file passed verification")
+	}
+
+	if _, err := a.WriteChecksums(testArchiveDist); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.VerifyChecksums(testArchiveDist); err != nil {
+		t.Error(err)
+	}
+
+	if err := ioutil.WriteFile(archive, []byte("tampered archive"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.VerifyChecksums(testArchiveDist); err == nil {
+		t.Error("tampered archive passed verification")
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(testArchiveDist, ChecksumsFileName), []byte("\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.VerifyChecksums(testArchiveDist); err == nil {
+		t.Error("empty checksums file passed verification")
+	}
+}
@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"io/ioutil"
+
 	"gopkg.in/src-d/go-git.v4"
 	"gopkg.in/src-d/go-git.v4/plumbing"
 	"gopkg.in/src-d/go-git.v4/plumbing/object"
@@ -21,7 +23,8 @@ func NewBinaryManager(dir string, stdoutChan, stderrChan chan string) *BinaryMan
 	}
 }
 
-func getLatestGitTag(dir string) (string, error) {
+// GetLatestGitTag returns the name of the most recently committed Git tag in a repository
+func GetLatestGitTag(dir string) (string, error) {
 	// Based on https://github.com/src-d/go-git/issues/1030#issuecomment-443679681
 	repository, err := git.PlainOpen(dir)
 
@@ -66,14 +69,25 @@ func getLatestGitTag(dir string) (string, error) {
 	return "", err
 }
 
-// Push releases a binary to GitHub releases
-func (b *BinaryManager) Push(githubUserName, githubToken, githubRepository, dir, assetOut string) error {
-	version, err := getLatestGitTag(dir)
+// Push releases a binary to GitHub releases; if releaseNotes is set, the file's content is used as the release's body,
+// so an error is returned if it can't be read instead of publishing the release without it
+func (b *BinaryManager) Push(githubUserName, githubToken, githubRepository, dir, assetOut, releaseNotes string) error {
+	version, err := GetLatestGitTag(dir)
 	if err != nil {
 		return err
 	}
 
-	command := NewManageableCommand("ghr -replace -t "+githubToken+" -u "+githubUserName+" -r "+githubRepository+" "+version+" "+assetOut, b.dir, b.stdoutChan, b.stderrChan)
+	body := ""
+	if releaseNotes != "" {
+		notes, err := ioutil.ReadFile(releaseNotes)
+		if err != nil {
+			return err
+		}
+
+		body = " -b " + quoteShellArg(string(notes))
+	}
+
+	command := NewManageableCommand("ghr -replace -t "+githubToken+" -u "+githubUserName+" -r "+githubRepository+body+" "+version+" "+assetOut, b.dir, b.stdoutChan, b.stderrChan)
 
 	if err := command.Start(); err != nil {
 		return err
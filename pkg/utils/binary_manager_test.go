@@ -1,8 +1,10 @@
 package utils
 
 import (
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -65,8 +67,70 @@ func TestPushBinaryManager(t *testing.T) {
 			os.Getenv("DIBS_GITHUB_REPOSITORY"),
 			testRepoRoot,
 			testAssetOut,
+			"",
 		); err != nil {
 			t.Error(err)
 		}
 	}
 }
+
+func TestPushReleaseNotesBinaryManager(t *testing.T) {
+	setupChangelogTest(t)
+
+	dir, err := ioutil.TempDir("", "dibs-release-notes-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The fake ghr prints its arguments, so that the body can be checked
+	if err := ioutil.WriteFile(filepath.Join(dir, "ghr"), []byte("#!/bin/sh\nfor arg in \"$@\"; do echo \"ARG $arg\"; done\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	releaseNotes := filepath.Join(dir, "release notes; touch pwned.md")
+	notes := "## Features\n\n- Don't run $(touch pwned) or `touch pwned`"
+	if err := ioutil.WriteFile(releaseNotes, []byte(notes), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+
+	var args []string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		for {
+			select {
+			case stdout, ok := <-stdoutChan:
+				if !ok {
+					return
+				}
+
+				args = append(args, stdout)
+			case stderr := <-stderrChan:
+				t.Error("error while pushing binary", stderr)
+			}
+		}
+	}()
+
+	if err := NewBinaryManager(dir, stdoutChan, stderrChan).Push("user", "token", "repo", testChangelogRepo, "asset", releaseNotes); err != nil {
+		t.Fatal(err)
+	}
+	close(stdoutChan)
+	<-done
+
+	if body := strings.Join(args, "\n"); !strings.Contains(body, "ARG -b\nARG "+notes+"\nARG v") {
+		t.Errorf("arguments of ghr are %q, expected the release notes as the body", body)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "pwned")); err == nil {
+		t.Error("release notes have been run by the shell")
+	}
+
+	if err := NewBinaryManager(dir, nil, nil).Push("user", "token", "repo", testChangelogRepo, "asset", filepath.Join(dir, "missing.md")); err == nil {
+		t.Error("missing release notes did not return an error")
+	}
+}
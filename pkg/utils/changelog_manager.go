@@ -0,0 +1,349 @@
+package utils
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+var (
+	semverRegex             = regexp.MustCompile(`^v?(\d+)\.(\d+)\.(\d+)(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+	conventionalCommitRegex = regexp.MustCompile(`^(\w+)(?:\(([^)]*)\))?(!)?: (.+)$`)
+	changelogSections       = []struct {
+		commitType, title string
+	}{
+		{"feat", "Features"},
+		{"fix", "Bug Fixes"},
+		{"perf", "Performance Improvements"},
+		{"refactor", "Refactorings"},
+		{"docs", "Documentation"},
+		{"test", "Tests"},
+		{"build", "Build System"},
+		{"ci", "Continuous Integration"},
+		{"style", "Styles"},
+		{"chore", "Chores"},
+	}
+)
+
+const (
+	breakingChangesTitle = "Breaking Changes"
+	otherChangesTitle    = "Other Changes"
+)
+
+// Semver is a parsed semantic version
+type Semver struct {
+	Major, Minor, Patch int
+	Prerelease          string
+}
+
+// ParseSemver parses a semantic version such as `v1.2.3-rc.1`
+func ParseSemver(version string) (Semver, error) {
+	matches := semverRegex.FindStringSubmatch(version)
+	if matches == nil {
+		return Semver{}, errors.New(version + " is not a semantic version")
+	}
+
+	var parts [3]int
+	for i := range parts {
+		part, err := strconv.Atoi(matches[i+1])
+		if err != nil {
+			return Semver{}, err
+		}
+
+		parts[i] = part
+	}
+
+	return Semver{
+		Major:      parts[0],
+		Minor:      parts[1],
+		Patch:      parts[2],
+		Prerelease: matches[4],
+	}, nil
+}
+
+// Less returns true if s has a lower precedence than other
+func (s Semver) Less(other Semver) bool {
+	if s.Major != other.Major {
+		return s.Major < other.Major
+	}
+	if s.Minor != other.Minor {
+		return s.Minor < other.Minor
+	}
+	if s.Patch != other.Patch {
+		return s.Patch < other.Patch
+	}
+
+	// A version without a prerelease has a higher precedence than one with a prerelease
+	if s.Prerelease == "" || other.Prerelease == "" {
+		return s.Prerelease != "" && other.Prerelease == ""
+	}
+
+	return comparePrereleases(s.Prerelease, other.Prerelease) < 0
+}
+
+// comparePrereleases compares the dot-separated identifiers of two prereleases as semver specifies:
+// numeric identifiers are compared as numbers and have a lower precedence than alphanumeric ones, and more identifiers have a higher precedence
+func comparePrereleases(a, b string) int {
+	identifiersA, identifiersB := strings.Split(a, "."), strings.Split(b, ".")
+
+	for i := 0; i < len(identifiersA) && i < len(identifiersB); i++ {
+		identifierA, identifierB := identifiersA[i], identifiersB[i]
+		if identifierA == identifierB {
+			continue
+		}
+
+		numberA, errA := strconv.ParseUint(identifierA, 10, 64)
+		numberB, errB := strconv.ParseUint(identifierB, 10, 64)
+
+		switch {
+		case errA == nil && errB == nil:
+			if numberA < numberB {
+				return -1
+			}
+
+			return 1
+		case errA == nil:
+			return -1
+		case errB == nil:
+			return 1
+		case identifierA < identifierB:
+			return -1
+		default:
+			return 1
+		}
+	}
+
+	switch {
+	case len(identifiersA) < len(identifiersB):
+		return -1
+	case len(identifiersA) > len(identifiersB):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// ConventionalCommit is a commit message following the Conventional Commits specification
+type ConventionalCommit struct {
+	Type, Scope, Description, Hash string
+	Breaking                       bool
+}
+
+// ParseConventionalCommit parses a commit message; commits not following the specification have an empty type
+func ParseConventionalCommit(hash, message string) ConventionalCommit {
+	lines := strings.SplitN(strings.TrimSpace(message), "\n", 2)
+
+	commit := ConventionalCommit{
+		Description: strings.TrimSpace(lines[0]),
+		Hash:        hash,
+	}
+
+	if matches := conventionalCommitRegex.FindStringSubmatch(commit.Description); matches != nil {
+		commit.Type = strings.ToLower(matches[1])
+		commit.Scope = matches[2]
+		commit.Breaking = matches[3] == "!"
+		commit.Description = matches[4]
+	}
+
+	if len(lines) > 1 && (strings.Contains(lines[1], "BREAKING CHANGE:") || strings.Contains(lines[1], "BREAKING-CHANGE:")) {
+		commit.Breaking = true
+	}
+
+	return commit
+}
+
+// ChangelogManager manages changelogs and release notes
+type ChangelogManager struct {
+	dir                    string
+	stdoutChan, stderrChan chan string
+}
+
+// NewChangelogManager creates a new ChangelogManager
+func NewChangelogManager(dir string, stdoutChan, stderrChan chan string) *ChangelogManager {
+	return &ChangelogManager{
+		dir:        dir,
+		stdoutChan: stdoutChan,
+		stderrChan: stderrChan,
+	}
+}
+
+type semverTag struct {
+	name    string
+	version Semver
+	hash    plumbing.Hash
+}
+
+func getSemverTags(repository *git.Repository) ([]semverTag, error) {
+	tagRefs, err := repository.Tags()
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []semverTag
+	if err := tagRefs.ForEach(func(tagRef *plumbing.Reference) error {
+		version, err := ParseSemver(tagRef.Name().Short())
+		if err != nil {
+			return nil
+		}
+
+		// Resolve annotated tags to the commits they point to
+		hash, err := repository.ResolveRevision(plumbing.Revision(tagRef.Name().String()))
+		if err != nil {
+			return err
+		}
+
+		tags = append(tags, semverTag{
+			name:    tagRef.Name().Short(),
+			version: version,
+			hash:    *hash,
+		})
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].version.Less(tags[j].version)
+	})
+
+	return tags, nil
+}
+
+func getReachableCommits(repository *git.Repository, from plumbing.Hash) (map[plumbing.Hash]bool, error) {
+	commits, err := repository.Log(&git.LogOptions{From: from})
+	if err != nil {
+		return nil, err
+	}
+
+	reachable := map[plumbing.Hash]bool{}
+	if err := commits.ForEach(func(commit *object.Commit) error {
+		reachable[commit.Hash] = true
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return reachable, nil
+}
+
+// GetCommits returns the commits between the previous semver tag and tag (or the latest semver tag if tag is empty)
+func (c *ChangelogManager) GetCommits(gitRepoRoot, tag string) (string, []ConventionalCommit, error) {
+	repository, err := git.PlainOpen(gitRepoRoot)
+	if err != nil {
+		return "", nil, err
+	}
+
+	tags, err := getSemverTags(repository)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(tags) == 0 {
+		return "", nil, errors.New("no semantic version tags found in " + gitRepoRoot)
+	}
+
+	current := len(tags) - 1
+	if tag != "" {
+		current = -1
+		for i, candidate := range tags {
+			if candidate.name == tag {
+				current = i
+			}
+		}
+
+		if current == -1 {
+			return "", nil, errors.New("tag " + tag + " not found in " + gitRepoRoot)
+		}
+	}
+
+	previous := map[plumbing.Hash]bool{}
+	if current > 0 {
+		previous, err = getReachableCommits(repository, tags[current-1].hash)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	log, err := repository.Log(&git.LogOptions{From: tags[current].hash})
+	if err != nil {
+		return "", nil, err
+	}
+
+	var commits []ConventionalCommit
+	if err := log.ForEach(func(commit *object.Commit) error {
+		if !previous[commit.Hash] {
+			commits = append(commits, ParseConventionalCommit(commit.Hash.String(), commit.Message))
+		}
+
+		return nil
+	}); err != nil {
+		return "", nil, err
+	}
+
+	return tags[current].name, commits, nil
+}
+
+func formatChangelogEntry(commit ConventionalCommit) string {
+	entry := "- "
+	if commit.Scope != "" {
+		entry += "**" + commit.Scope + ":** "
+	}
+
+	return entry + commit.Description + " (" + commit.Hash[:7] + ")\n"
+}
+
+// Generate generates Markdown release notes for tag (or the latest semver tag if tag is empty), grouped by commit type
+func (c *ChangelogManager) Generate(gitRepoRoot, tag string) (string, error) {
+	version, commits, err := c.GetCommits(gitRepoRoot, tag)
+	if err != nil {
+		return "", err
+	}
+
+	notes := "## " + version + "\n"
+
+	var breaking string
+	for _, commit := range commits {
+		if commit.Breaking {
+			breaking += formatChangelogEntry(commit)
+		}
+	}
+	if breaking != "" {
+		notes += "\n### " + breakingChangesTitle + "\n\n" + breaking
+	}
+
+	knownTypes := map[string]bool{}
+	for _, section := range changelogSections {
+		knownTypes[section.commitType] = true
+
+		var entries string
+		for _, commit := range commits {
+			if commit.Type == section.commitType {
+				entries += formatChangelogEntry(commit)
+			}
+		}
+
+		if entries != "" {
+			notes += "\n### " + section.title + "\n\n" + entries
+		}
+	}
+
+	var other string
+	for _, commit := range commits {
+		if !knownTypes[commit.Type] {
+			other += formatChangelogEntry(commit)
+		}
+	}
+	if other != "" {
+		notes += "\n### " + otherChangesTitle + "\n\n" + other
+	}
+
+	return notes, nil
+}
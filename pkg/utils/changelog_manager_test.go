@@ -0,0 +1,181 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+var (
+	testChangelogRepo = filepath.Join(os.TempDir(), "test-changelog-repo")
+)
+
+func setupChangelogTest(t *testing.T) {
+	if err := os.RemoveAll(testChangelogRepo); err != nil {
+		t.Fatal(err)
+	}
+
+	repository, err := git.PlainInit(testChangelogRepo, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wt, err := repository.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, step := range []struct {
+		message, tag string
+	}{
+		{"feat: Add initial version", "v0.0.1"},
+		{"feat(api): Add users endpoint", ""},
+		{"fix: Fix crash on startup", ""},
+		{"chore: Update Helm charts", ""},
+		{"feat!: Drop support for old config files", ""},
+		{"Update README", "v0.1.0"},
+		{"fix: Fix typo", ""},
+	} {
+		if err := ioutil.WriteFile(filepath.Join(testChangelogRepo, "file"), []byte(step.message), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := wt.Add("file"); err != nil {
+			t.Fatal(err)
+		}
+
+		hash, err := wt.Commit(step.message, &git.CommitOptions{
+			Author: &object.Signature{Name: "dibs", Email: "dibs@example.com", When: time.Now().Add(time.Duration(i) * time.Second)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if step.tag != "" {
+			if _, err := repository.CreateTag(step.tag, hash, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestCreateChangelogManager(t *testing.T) {
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+
+	c := NewChangelogManager(testContext, stdoutChan, stderrChan)
+
+	if c == nil {
+		t.Error("New changelog manager is nil")
+	}
+
+	if c.dir != testContext {
+		t.Error("dir not set correctly")
+	}
+
+	if c.stdoutChan != stdoutChan {
+		t.Error("stdoutChan not set correctly")
+	}
+
+	if c.stderrChan != stderrChan {
+		t.Error("stderrChan not correctly")
+	}
+}
+
+func TestParseSemver(t *testing.T) {
+	// The order of the prereleases is the example of the semver specification
+	versions := []string{"v0.0.1-alpha", "v0.0.1-alpha.1", "v0.0.1-alpha.beta", "v0.0.1-beta", "v0.0.1-beta.2", "v0.0.1-beta.11", "v0.0.1-rc.1", "v0.0.1-rc.2", "v0.0.1-rc.10", "v0.0.1", "0.1.0", "v0.10.0", "v1.0.0"}
+
+	for i := 0; i < len(versions)-1; i++ {
+		lower, err := ParseSemver(versions[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		higher, err := ParseSemver(versions[i+1])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !lower.Less(higher) || higher.Less(lower) {
+			t.Error(versions[i], "is not lower than", versions[i+1])
+		}
+	}
+
+	if _, err := ParseSemver("latest"); err == nil {
+		t.Error("invalid version did not return an error")
+	}
+}
+
+func TestParseConventionalCommit(t *testing.T) {
+	commit := ParseConventionalCommit("abc", "feat(api)!: Add users endpoint\n\nSome details")
+
+	if commit.Type != "feat" || commit.Scope != "api" || !commit.Breaking || commit.Description != "Add users endpoint" {
+		t.Error("commit not parsed correctly", commit)
+	}
+
+	commit = ParseConventionalCommit("abc", "fix: Fix crash\n\nBREAKING CHANGE: The flag has been removed")
+	if commit.Type != "fix" || !commit.Breaking {
+		t.Error("breaking change footer not parsed correctly", commit)
+	}
+
+	commit = ParseConventionalCommit("abc", "Update README")
+	if commit.Type != "" || commit.Description != "Update README" {
+		t.Error("non-conventional commit not parsed correctly", commit)
+	}
+}
+
+func TestGenerateChangelogManager(t *testing.T) {
+	setupChangelogTest(t)
+
+	c := NewChangelogManager(testChangelogRepo, make(chan string), make(chan string))
+
+	notes, err := c.Generate(testChangelogRepo, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"## v0.1.0",
+		"### Breaking Changes\n\n- Drop support for old config files",
+		"### Features\n\n- Drop support for old config files",
+		"- **api:** Add users endpoint",
+		"### Bug Fixes\n\n- Fix crash on startup",
+		"### Chores\n\n- Update Helm charts",
+		"### Other Changes\n\n- Update README",
+	} {
+		if !strings.Contains(notes, expected) {
+			t.Error("release notes do not contain", expected, "\n", notes)
+		}
+	}
+
+	for _, unexpected := range []string{"Add initial version", "Fix typo"} {
+		if strings.Contains(notes, unexpected) {
+			t.Error("release notes contain commit outside of the tag range", unexpected)
+		}
+	}
+}
+
+func TestGenerateFirstTagChangelogManager(t *testing.T) {
+	setupChangelogTest(t)
+
+	c := NewChangelogManager(testChangelogRepo, make(chan string), make(chan string))
+
+	notes, err := c.Generate(testChangelogRepo, "v0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(notes, "## v0.0.1") || !strings.Contains(notes, "- Add initial version") {
+		t.Error("release notes for the first tag are not correct", notes)
+	}
+
+	if _, err := c.Generate(testChangelogRepo, "v9.9.9"); err == nil {
+		t.Error("missing tag did not return an error")
+	}
+}
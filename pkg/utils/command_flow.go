@@ -1,17 +1,236 @@
 package utils
 
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/format/gitignore"
+)
+
+const (
+	// ChangedFilesEnv is the env variable which contains the files that changed since the last run, separated by the OS's path list separator
+	ChangedFilesEnv = "DIBS_CHANGED_FILES"
+	// ChangedFilesListEnv is the env variable which contains the path of a file that lists the files which changed since the last run, one per line
+	ChangedFilesListEnv = "DIBS_CHANGED_FILES_LIST"
+	// DefaultRestartBackoff is the time after which a service is restarted for the first time if none is set
+	DefaultRestartBackoff = time.Second
+	// MaxRestartBackoff is the maximum time after which a service is restarted.
+	// The time doubles with every restart until the service has been running for this long.
+	MaxRestartBackoff = time.Second * 30
+
+	// RestartPolicyNever never restarts services which have exited
+	RestartPolicyNever = "never"
+	// RestartPolicyOnFailure restarts services which have exited with a non-zero exit code or because of a signal
+	RestartPolicyOnFailure = "on-failure"
+	// RestartPolicyAlways restarts services whenever they have exited
+	RestartPolicyAlways = "always"
+)
+
+// StageRule maps changed files which match Pattern (in .gitignore syntax) to the earliest Stage which must rerun
+type StageRule struct {
+	Pattern string
+	Stage   string
+}
+
+// GetRestartStage returns the index of the earliest stage in stages which must rerun for the changed files in root.
+// Files which don't match any rule or whose rule's stage is not in stages rerun all stages.
+func GetRestartStage(root string, changedFiles []string, rules []StageRule, stages []string) int {
+	if len(rules) == 0 || len(changedFiles) == 0 {
+		return 0
+	}
+
+	restartStage := len(stages) - 1
+	for _, changedFile := range changedFiles {
+		rel, err := filepath.Rel(root, changedFile)
+		if err != nil {
+			return 0
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+
+		// Like in .gitignore files, the last matching rule wins
+		fileStage := -1
+		for _, rule := range rules {
+			if !gitignore.NewMatcher([]gitignore.Pattern{gitignore.ParsePattern(rule.Pattern, nil)}).Match(parts, false) {
+				continue
+			}
+
+			ruleStage := -1
+			for i, stage := range stages {
+				if stage == rule.Stage {
+					ruleStage = i
+				}
+			}
+
+			fileStage = ruleStage
+		}
+
+		if fileStage == -1 {
+			return 0
+		}
+
+		if fileStage < restartStage {
+			restartStage = fileStage
+		}
+	}
+
+	if restartStage < 0 {
+		return 0
+	}
+
+	return restartStage
+}
+
+// StageError is returned if a stage fails while restarting a CommandFlow
+type StageError struct {
+	Stage    int
+	ExecLine string
+	Err      error
+}
+
+func (e *StageError) Error() string {
+	return "stage " + strconv.Itoa(e.Stage) + " (" + e.ExecLine + ") failed: " + e.Err.Error()
+}
+
+// StageFailuresError is returned if stages have failed but the CommandFlow has continued anyway, e.g. because their failures are allowed
+type StageFailuresError struct {
+	Failures []*StageError
+}
+
+func (e *StageFailuresError) Error() string {
+	var failures []string
+	for _, failure := range e.Failures {
+		failures = append(failures, failure.Error())
+	}
+
+	return strings.Join(failures, "; ")
+}
+
+// Service is a long-running command of a CommandFlow, which is started after all other commands have completed
+type Service struct {
+	// Name is used to prefix the service's log lines; services without a name are not prefixed
+	Name    string
+	Command string
+	// DependsOn are the names of the services which must be started (and ready, if they have a readiness probe) before this one
+	DependsOn []string
+	// RestartOnChange restarts the service when the flow is restarted; otherwise it keeps running
+	RestartOnChange bool
+	// Readiness is checked after the service has been started until it succeeds or fails FailureThreshold times
+	Readiness *Probe
+	// Liveness is checked once the service is ready; if it fails FailureThreshold times in a row, the service is restarted
+	Liveness *Probe
+	// RestartPolicy decides whether the service is restarted if it exits; defaults to RestartPolicyNever
+	RestartPolicy string
+	// MaxRetries is the number of restarts after which a service which keeps exiting or failing its liveness probe is given up on; 0 means no limit
+	MaxRetries int
+	// Backoff is the time after which the service is restarted for the first time; defaults to DefaultRestartBackoff
+	Backoff time.Duration
+	// Debugger launches the service's asset instead of Command while the flow is debugging, see SetDebug
+	Debugger *Debugger
+}
+
 // CommandFlow is a manageable collection of commands
 type CommandFlow struct {
+	// isRestart is set while the flow is being restarted, so that Wait doesn't return while its commands are being replaced
 	isRestart bool
-	commands  []*ManageableCommand
+	// commands are the stages, followed by the commands of the services
+	commands []*ManageableCommand
+	services []Service
+	// restarting is the command of a stage which is being rerun while the services keep running
+	restarting *ManageableCommand
+	// launching is the number of debuggers which are waiting for their port to be free before they are launched
+	launching int
+	// skipped are the indexes of the stages which are not run when the flow is started or restarted
+	skipped map[int]bool
+	// allowedFailures are the indexes of the stages which don't stop the flow from being restarted if they fail
+	allowedFailures map[int]bool
+
+	stdoutChan, stderrChan chan string
+	readiness, liveness    []*probeRunner
+	// debugReadiness[i] checks whether the debugger of service i is listening if the service has no readiness probe
+	debugReadiness []*probeRunner
+	debug          bool
+	// ready[i] is closed once service i is ready or its readiness probe has failed
+	ready []chan struct{}
+	// monitors[i] is closed to stop monitoring the running command of service i
+	monitors []chan struct{}
+	backoffs []time.Duration
+	retries  []int
+	// commandsLock must be held while commands, isRestart, restarting or launching are accessed and while skipped or allowedFailures are accessed
+	commandsLock sync.Mutex
+	done         chan struct{}
+	stopOnce     sync.Once
 }
 
-// NewCommandFlow creates a new CommandFlow
-func NewCommandFlow(commands []string, dir string, stdoutChan, stderrChan chan string) *CommandFlow {
+func newCommandFlow(services []Service, stdoutChan, stderrChan chan string) (*CommandFlow, error) {
 	commandFlow := &CommandFlow{
-		isRestart: false,
+		isRestart:       false,
+		services:        append([]Service{}, services...),
+		stdoutChan:      stdoutChan,
+		stderrChan:      stderrChan,
+		readiness:       make([]*probeRunner, len(services)),
+		liveness:        make([]*probeRunner, len(services)),
+		debugReadiness:  make([]*probeRunner, len(services)),
+		ready:           make([]chan struct{}, len(services)),
+		monitors:        make([]chan struct{}, len(services)),
+		backoffs:        make([]time.Duration, len(services)),
+		retries:         make([]int, len(services)),
+		done:            make(chan struct{}),
+		skipped:         map[int]bool{},
+		allowedFailures: map[int]bool{},
+	}
+
+	for i, service := range services {
+		switch service.RestartPolicy {
+		case "":
+			commandFlow.services[i].RestartPolicy = RestartPolicyNever
+		case RestartPolicyNever, RestartPolicyOnFailure, RestartPolicyAlways:
+		default:
+			return nil, errors.New("unknown restart policy " + service.RestartPolicy + " for service " + service.Name + ", use " + RestartPolicyNever + ", " + RestartPolicyOnFailure + " or " + RestartPolicyAlways)
+		}
+
+		readiness, err := newProbeRunner(service.Readiness, DefaultReadinessFailureThreshold)
+		if err != nil {
+			return nil, errors.New("invalid readiness probe for service " + service.Name + ": " + err.Error())
+		}
+
+		liveness, err := newProbeRunner(service.Liveness, DefaultLivenessFailureThreshold)
+		if err != nil {
+			return nil, errors.New("invalid liveness probe for service " + service.Name + ": " + err.Error())
+		}
+
+		commandFlow.readiness[i], commandFlow.liveness[i] = readiness, liveness
+
+		if service.Debugger == nil {
+			continue
+		}
+
+		if _, err := service.Debugger.GetExecLine(); err != nil {
+			return nil, errors.New("invalid debugger for service " + service.Name + ": " + err.Error())
+		}
+
+		if readiness == nil {
+			// Probes with a TCP address are always valid
+			commandFlow.debugReadiness[i], _ = newProbeRunner(&Probe{TCP: service.Debugger.getDialAddress()}, DefaultReadinessFailureThreshold)
+		}
 	}
 
+	return commandFlow, nil
+}
+
+// NewCommandFlow creates a new CommandFlow; the last command is run as a service
+func NewCommandFlow(commands []string, dir string, stdoutChan, stderrChan chan string) *CommandFlow {
+	var services []Service
+	if len(commands) > 0 {
+		services = []Service{{Command: commands[len(commands)-1], RestartOnChange: true}}
+	}
+
+	// Services without probes are always valid
+	commandFlow, _ := newCommandFlow(services, stdoutChan, stderrChan)
+
 	for _, command := range commands {
 		manageableCommand := NewManageableCommand(command, dir, stdoutChan, stderrChan)
 
@@ -21,70 +240,618 @@ func NewCommandFlow(commands []string, dir string, stdoutChan, stderrChan chan s
 	return commandFlow
 }
 
-func (f *CommandFlow) recreateCommands() error {
-	var newCommands []*ManageableCommand
+// NewServiceCommandFlow creates a new CommandFlow which runs the stages and then starts the services in the order of their dependencies
+func NewServiceCommandFlow(stages []string, services []Service, dir string, stdoutChan, stderrChan chan string) (*CommandFlow, error) {
+	orderedServices, err := orderServices(services)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, command := range f.commands {
-		manageableCommand := NewManageableCommand(command.GetExecLine(), command.GetDir(), command.GetStdoutChan(), command.GetStderrChan())
+	commandFlow, err := newCommandFlow(orderedServices, stdoutChan, stderrChan)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stage := range stages {
+		commandFlow.commands = append(commandFlow.commands, NewManageableCommand(stage, dir, stdoutChan, stderrChan))
+	}
+
+	for i, service := range orderedServices {
+		serviceStdoutChan, serviceStderrChan := stdoutChan, stderrChan
+
+		var logProbes []*probeRunner
+		for _, probe := range []*probeRunner{commandFlow.readiness[i], commandFlow.liveness[i]} {
+			if probe != nil && probe.logRegex != nil {
+				logProbes = append(logProbes, probe)
+			}
+		}
+
+		if service.Name != "" || len(logProbes) > 0 {
+			serviceStdoutChan, serviceStderrChan = make(chan string), make(chan string)
+
+			go forwardLines(getServicePrefix(service), serviceStdoutChan, stdoutChan, logProbes)
+			go forwardLines(getServicePrefix(service), serviceStderrChan, stderrChan, logProbes)
+		}
+
+		commandFlow.commands = append(commandFlow.commands, NewManageableCommand(service.Command, dir, serviceStdoutChan, serviceStderrChan))
+	}
+
+	return commandFlow, nil
+}
+
+func getServicePrefix(service Service) string {
+	if service.Name == "" {
+		return ""
+	}
+
+	return "[" + service.Name + "] "
+}
+
+// forwardLines prefixes the lines of a service and passes them to its log probes
+func forwardLines(prefix string, in, out chan string, logProbes []*probeRunner) {
+	for line := range in {
+		for _, probe := range logProbes {
+			probe.observe(line)
+		}
+
+		out <- prefix + line
+	}
+}
 
-		newCommands = append(newCommands, manageableCommand)
+// orderServices sorts services so that every service comes after the services it depends on
+func orderServices(services []Service) ([]Service, error) {
+	servicesByName := map[string]Service{}
+	for _, service := range services {
+		if _, exists := servicesByName[service.Name]; exists && service.Name != "" {
+			return nil, errors.New("duplicate service " + service.Name)
+		}
+
+		servicesByName[service.Name] = service
+	}
+
+	var (
+		ordered []Service
+		visit   func(service Service, path []string) error
+	)
+	visited := map[string]bool{}
+	visiting := map[string]bool{}
+
+	visit = func(service Service, path []string) error {
+		if visited[service.Name] && service.Name != "" {
+			return nil
+		}
+
+		if visiting[service.Name] {
+			return errors.New("circular service dependency: " + strings.Join(append(path, service.Name), " -> "))
+		}
+
+		visiting[service.Name] = true
+		for _, dependency := range service.DependsOn {
+			dependencyService, exists := servicesByName[dependency]
+			if !exists || dependency == "" {
+				return errors.New("service " + service.Name + " depends on unknown service " + dependency)
+			}
+
+			if err := visit(dependencyService, append(path, service.Name)); err != nil {
+				return err
+			}
+		}
+		visiting[service.Name] = false
+
+		visited[service.Name] = true
+		ordered = append(ordered, service)
+
+		return nil
+	}
+
+	for _, service := range services {
+		if err := visit(service, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return ordered, nil
+}
+
+// firstService returns the index of the first service's command
+func (f *CommandFlow) firstService() int {
+	return len(f.commands) - len(f.services)
+}
+
+func recreateCommand(command *ManageableCommand, env []string) *ManageableCommand {
+	manageableCommand := NewManageableCommand(command.GetExecLine(), command.GetDir(), command.GetStdoutChan(), command.GetStderrChan())
+
+	if env != nil {
+		manageableCommand.SetEnv(env)
+	} else {
+		manageableCommand.SetEnv(command.GetEnv())
 	}
 
-	for i, command := range newCommands {
+	return manageableCommand
+}
+
+// rerunStages reruns the stages from index from up to (excluding) index to while the services keep running.
+// The commands of the stages are replaced once they have succeeded; skipped stages are only rerun if includeSkipped is set.
+// Stages whose failures are allowed are replaced even if they fail; their failures are returned as a StageFailuresError once all stages have run.
+func (f *CommandFlow) rerunStages(from, to int, env []string, includeSkipped bool) error {
+	var failures []*StageError
+	for i := from; i < to; i++ {
+		if f.isSkipped(i) && !includeSkipped {
+			continue
+		}
+
+		f.commandsLock.Lock()
+		// The flow might have been stopped while the previous stage was running
+		select {
+		case <-f.done:
+			f.commandsLock.Unlock()
+
+			return nil
+		default:
+		}
+
+		command := recreateCommand(f.commands[i], env)
+
 		if err := command.Start(); err != nil {
+			f.commandsLock.Unlock()
+
 			return err
 		}
+		f.restarting = command
+		f.commandsLock.Unlock()
+
+		err := command.Wait()
+
+		f.commandsLock.Lock()
+		f.restarting = nil
+		if err == nil || f.allowedFailures[i] {
+			f.commands[i] = command
+		}
+		f.commandsLock.Unlock()
+
+		if err != nil {
+			stageErr := &StageError{Stage: i, ExecLine: command.GetExecLine(), Err: err}
+			if !f.isFailureAllowed(i) {
+				return stageErr
+			}
 
-		// We don't have to wait for the last one to ensure serial execution
-		if i != len(newCommands)-1 {
-			_ = command.Wait()
+			failures = append(failures, stageErr)
 		}
 	}
 
-	f.commands = newCommands
+	if len(failures) > 0 {
+		return &StageFailuresError{Failures: failures}
+	}
 
 	return nil
 }
 
-// Start starts the command flow
-func (f *CommandFlow) Start() error {
-	// TODO: Add test that ensures serial execution of commands
-	for i, command := range f.commands {
-		if err := command.Start(); err != nil {
-			return err
+func (f *CommandFlow) logService(service int, toStderr bool, message string) {
+	outChan := f.stdoutChan
+	if toStderr {
+		outChan = f.stderrChan
+	}
+
+	select {
+	case outChan <- getServicePrefix(f.services[service]) + message:
+	case <-f.done:
+	}
+}
+
+// isStopping returns true if monitor has been closed or the flow is being stopped
+func (f *CommandFlow) isStopping(monitor chan struct{}) bool {
+	select {
+	case <-monitor:
+		return true
+	case <-f.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// startService starts the command of service and monitors its probes; the commandsLock must be held
+func (f *CommandFlow) startService(service int) error {
+	// The flow might have been stopped while the commandsLock was not held
+	select {
+	case <-f.done:
+		return nil
+	default:
+	}
+
+	for _, dependency := range f.services[service].DependsOn {
+		for i := 0; i < service; i++ {
+			if f.services[i].Name != dependency || f.ready[i] == nil {
+				continue
+			}
+
+			select {
+			case <-f.ready[i]:
+			case <-f.done:
+				return nil
+			}
 		}
+	}
+
+	index := f.firstService() + service
+	command := f.commands[index]
+	readiness, liveness := f.readiness[service], f.liveness[service]
+
+	execLine, stopTimeout := f.services[service].Command, time.Duration(0)
+	var debugger *Debugger
+	if f.debug && f.services[service].Debugger != nil {
+		debugger = f.services[service].Debugger
+
+		// The debugger has been validated when the flow was created
+		execLine, _ = debugger.GetExecLine()
+		stopTimeout = DefaultDebuggerStopTimeout
 
-		// We don't have to wait for the last one to ensure serial execution
-		if i != len(f.commands)-1 {
-			_ = command.Wait()
+		if f.debugReadiness[service] != nil {
+			readiness = f.debugReadiness[service]
 		}
+
+		// The app might be paused at a breakpoint, so it would not be alive
+		liveness = nil
+	}
+
+	// Switching to or from the debugger replaces the command
+	if command.GetExecLine() != execLine {
+		switchedCommand := NewManageableCommand(execLine, command.GetDir(), command.GetStdoutChan(), command.GetStderrChan())
+		switchedCommand.SetEnv(command.GetEnv())
+
+		command = switchedCommand
+		f.commands[index] = command
 	}
+	command.SetStopTimeout(stopTimeout)
+
+	ready, monitor := make(chan struct{}), make(chan struct{})
+	f.ready[service], f.monitors[service] = ready, monitor
+
+	if debugger == nil {
+		return f.launchService(service, command, readiness, liveness, ready, monitor)
+	}
+
+	// The debugger of a previous run might still be stopping, so it is launched once its port is free;
+	// the commandsLock is not held in the meantime, so that the status of the flow can be read while waiting
+	f.launching++
+	go func() {
+		if err := debugger.waitForPort(debugPortWaitTimeout); err != nil {
+			f.logService(service, true, err.Error())
+		}
+
+		f.commandsLock.Lock()
+		defer f.commandsLock.Unlock()
+
+		f.launching--
+
+		// The flow might have restarted or stopped the service while the lock was not held
+		if f.isStopping(monitor) {
+			close(ready)
+
+			return
+		}
+
+		if err := f.launchService(service, command, readiness, liveness, ready, monitor); err != nil {
+			f.logService(service, true, "Could not start debugger: "+err.Error())
+		}
+	}()
 
 	return nil
 }
 
-// Wait waits for the command flow to complete
-func (f *CommandFlow) Wait() error {
-	if f.isRestart {
-		return f.Wait()
+// launchService starts command of service and monitors it with its probes and restart policy until monitor is closed; the commandsLock must be held
+func (f *CommandFlow) launchService(service int, command *ManageableCommand, readiness, liveness *probeRunner, ready, monitor chan struct{}) error {
+	// Lines which are logged right after the start must be counted, so earlier lines are ignored before the command is started
+	if readiness != nil {
+		readiness.reset()
+	}
+
+	if err := command.Start(); err != nil {
+		close(ready)
+
+		return err
 	}
 
+	// Services which are not restarted and have no probes don't have to be monitored
+	if readiness == nil && liveness == nil && f.services[service].RestartPolicy == RestartPolicyNever {
+		close(ready)
+
+		return nil
+	}
+
+	go f.monitorService(service, command, readiness, liveness, ready, monitor)
+
+	return nil
+}
+
+// stopService stops monitoring service and stops its command; the commandsLock must be held
+func (f *CommandFlow) stopService(service int) error {
+	if monitor := f.monitors[service]; monitor != nil && !f.isStopping(monitor) {
+		close(monitor)
+	}
+
+	command := f.commands[f.firstService()+service]
+	if command.IsStopped() {
+		return nil
+	}
+
+	if err := command.Stop(); err != nil {
+		return err
+	}
+
+	// The service has been stopped on purpose, so it doesn't matter whether it has exited with an error
+	_ = command.Wait()
+
+	return nil
+}
+
+// monitorService checks the readiness probe of the command of service and then checks its liveness probe
+// and applies its restart policy until monitor is closed
+func (f *CommandFlow) monitorService(service int, command *ManageableCommand, readiness, liveness *probeRunner, ready, monitor chan struct{}) {
+	started := time.Now()
+
+	exited := make(chan struct{})
+	go func() {
+		_ = command.Wait()
+
+		close(exited)
+	}()
+
+	if readiness != nil {
+		ticker := time.NewTicker(readiness.probe.Interval)
+
+		var err error
+		for checks := 0; checks < readiness.probe.FailureThreshold; checks++ {
+			select {
+			case <-ticker.C:
+			case <-exited:
+				ticker.Stop()
+				close(ready)
+
+				if !f.isStopping(monitor) {
+					f.handleExit(service, command, monitor, started)
+				}
+
+				return
+			case <-monitor:
+			case <-f.done:
+			}
+
+			if f.isStopping(monitor) {
+				ticker.Stop()
+				close(ready)
+
+				return
+			}
+
+			if err = readiness.check(command.GetDir()); err == nil {
+				break
+			}
+		}
+		ticker.Stop()
+
+		if err != nil {
+			f.logService(service, true, "Service is not ready after "+time.Since(started).Round(time.Millisecond).String()+": "+err.Error())
+		} else {
+			f.logService(service, false, "Service is ready after "+time.Since(started).Round(time.Millisecond).String())
+		}
+	}
+	close(ready)
+
+	var checks <-chan time.Time
+	if liveness != nil {
+		liveness.reset()
+
+		ticker := time.NewTicker(liveness.probe.Interval)
+		defer ticker.Stop()
+
+		checks = ticker.C
+	}
+
+	failures := 0
+	for {
+		select {
+		case <-exited:
+			if !f.isStopping(monitor) {
+				f.handleExit(service, command, monitor, started)
+			}
+
+			return
+		case <-checks:
+			if err := liveness.check(command.GetDir()); err != nil {
+				failures++
+				if failures < liveness.probe.FailureThreshold {
+					continue
+				}
+
+				f.restartService(service, monitor, started, "Service is not alive: "+err.Error())
+
+				return
+			}
+
+			failures = 0
+		case <-monitor:
+			return
+		case <-f.done:
+			return
+		}
+	}
+}
+
+// handleExit reports the exit status of the command of service and restarts it if its restart policy requires it
+func (f *CommandFlow) handleExit(service int, command *ManageableCommand, monitor chan struct{}, started time.Time) {
+	reason := "Service exited (" + command.GetExitStatus() + ")"
+	failed := command.GetExitCode() != 0
+
+	switch policy := f.services[service].RestartPolicy; {
+	case policy == RestartPolicyAlways, policy == RestartPolicyOnFailure && failed:
+		f.restartService(service, monitor, started, reason)
+	default:
+		f.logService(service, failed, reason+", not restarting it because of its restart policy "+policy)
+	}
+}
+
+// restartService restarts service with an exponential backoff, unless monitor has been closed in the meantime or it has been retried too often
+func (f *CommandFlow) restartService(service int, monitor chan struct{}, started time.Time, reason string) {
+	f.commandsLock.Lock()
+	// Services which have been running for a while are not crashing in a loop, so they start with the initial backoff again
+	if time.Since(started) >= MaxRestartBackoff {
+		f.backoffs[service], f.retries[service] = 0, 0
+	}
+
+	maxRetries := f.services[service].MaxRetries
+	if maxRetries > 0 && f.retries[service] >= maxRetries {
+		f.commandsLock.Unlock()
+
+		f.logService(service, true, reason+", giving up after "+strconv.Itoa(maxRetries)+" retries")
+
+		return
+	}
+	f.retries[service]++
+	retry := strconv.Itoa(f.retries[service])
+	if maxRetries > 0 {
+		retry += " of " + strconv.Itoa(maxRetries)
+	}
+
+	backoff := f.backoffs[service]
+	if backoff == 0 {
+		backoff = f.services[service].Backoff
+	}
+	if backoff <= 0 {
+		backoff = DefaultRestartBackoff
+	}
+	f.backoffs[service] = backoff * 2
+	if f.backoffs[service] > MaxRestartBackoff {
+		f.backoffs[service] = MaxRestartBackoff
+	}
+	f.commandsLock.Unlock()
+
+	f.logService(service, true, reason+", restarting it in "+backoff.String()+" (retry "+retry+")")
+
+	select {
+	case <-time.After(backoff):
+	case <-monitor:
+		return
+	case <-f.done:
+		return
+	}
+
+	f.commandsLock.Lock()
+	defer f.commandsLock.Unlock()
+
+	// The flow might have restarted or stopped the service while the lock was not held
+	if f.isStopping(monitor) {
+		return
+	}
+
+	if err := f.stopService(service); err != nil {
+		f.logService(service, true, "Could not stop service: "+err.Error())
+
+		return
+	}
+
+	index := f.firstService() + service
+	f.commands[index] = recreateCommand(f.commands[index], nil)
+
+	if err := f.startService(service); err != nil {
+		f.logService(service, true, "Could not restart service: "+err.Error())
+	}
+}
+
+// SetEnv sets env variables for all commands of the flow; it must be called before Start
+func (f *CommandFlow) SetEnv(env []string) {
 	for _, command := range f.commands {
+		command.SetEnv(env)
+	}
+}
+
+// Start starts the command flow; the services are started even if stages fail, in which case a StageFailuresError is returned
+func (f *CommandFlow) Start() error {
+	// TODO: Add test that ensures serial execution of commands
+	var failures []*StageError
+	for i, command := range f.commands[:f.firstService()] {
+		if f.isSkipped(i) {
+			continue
+		}
+
+		if err := command.Start(); err != nil {
+			return err
+		}
+
 		if err := command.Wait(); err != nil {
+			failures = append(failures, &StageError{Stage: i, ExecLine: command.GetExecLine(), Err: err})
+		}
+	}
+
+	f.commandsLock.Lock()
+	defer f.commandsLock.Unlock()
+
+	// We don't have to wait for the services to ensure serial execution
+	for i := range f.services {
+		if err := f.startService(i); err != nil {
 			return err
 		}
 	}
 
-	if f.isRestart {
-		return f.Wait()
+	if len(failures) > 0 {
+		return &StageFailuresError{Failures: failures}
 	}
 
 	return nil
 }
 
+// Wait waits for the command flow to complete; commands which have been replaced by restarts in the meantime are waited for as well
+func (f *CommandFlow) Wait() error {
+	for {
+		f.commandsLock.Lock()
+		commands := append([]*ManageableCommand{}, f.commands...)
+		f.commandsLock.Unlock()
+
+		for _, command := range commands {
+			if err := command.Wait(); err != nil {
+				return err
+			}
+		}
+
+		f.commandsLock.Lock()
+		replaced, isRestart := false, f.isRestart || f.launching > 0
+		for i, command := range f.commands {
+			if command != commands[i] {
+				replaced = true
+
+				break
+			}
+		}
+		f.commandsLock.Unlock()
+
+		if !replaced && !isRestart {
+			return nil
+		}
+
+		// All commands might have exited while the stages are rerun or debuggers are waiting to be launched, in which case there is nothing to wait for until they are replaced
+		if !replaced {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+}
+
 // TODO: Add test that ensures that it waits until all have stopped (this is necessary so that ports don't block)
 // Stop stops the flow
 func (f *CommandFlow) Stop() error {
+	f.stopOnce.Do(func() {
+		close(f.done)
+	})
+
+	f.commandsLock.Lock()
+	defer f.commandsLock.Unlock()
+
+	if restarting := f.restarting; restarting != nil && !restarting.IsStopped() {
+		if err := restarting.Stop(); err != nil {
+			return err
+		}
+	}
+
+	// Services are stopped before the services they depend on
 	for i := len(f.commands) - 1; i >= 0; i-- {
 		command := f.commands[i]
 
@@ -104,19 +871,164 @@ func (f *CommandFlow) Stop() error {
 
 // Restart restarts the flow
 func (f *CommandFlow) Restart() error {
+	return f.RestartFrom(0, nil)
+}
+
+// RestartFrom restarts the flow from the command at index stage; if env is not nil, it replaces the env variables of the restarted commands.
+// The commands of earlier stages are kept and the services keep running until all restarted stages have succeeded;
+// if one of them fails, a StageError is returned and the services are not restarted.
+// Afterwards, all services which restart on changes are restarted; if stage is the index of a service, only the services are restarted.
+// If stages whose failures are allowed have failed, the services are restarted anyway and a StageFailuresError is returned.
+func (f *CommandFlow) RestartFrom(stage int, env []string) error {
 	// TODO: Add test that ensures serial execution of commands
 
+	if stage < 0 || stage >= len(f.commands) {
+		stage = 0
+	}
+	if stage > f.firstService() {
+		stage = f.firstService()
+	}
+
+	f.commandsLock.Lock()
 	f.isRestart = true
+	f.commandsLock.Unlock()
 
-	if err := f.Stop(); err != nil {
-		return err
+	defer func() {
+		f.commandsLock.Lock()
+		f.isRestart = false
+		f.commandsLock.Unlock()
+	}()
+
+	failures := f.rerunStages(stage, f.firstService(), env, false)
+	if _, ok := failures.(*StageFailuresError); failures != nil && !ok {
+		return failures
 	}
 
-	if err := f.recreateCommands(); err != nil {
-		return err
+	f.commandsLock.Lock()
+	defer f.commandsLock.Unlock()
+
+	for i := len(f.services) - 1; i >= 0; i-- {
+		if !f.services[i].RestartOnChange {
+			continue
+		}
+
+		if err := f.stopService(i); err != nil {
+			return err
+		}
 	}
 
-	f.isRestart = false
+	for i, service := range f.services {
+		if !service.RestartOnChange {
+			continue
+		}
+
+		index := f.firstService() + i
+		f.commands[index] = recreateCommand(f.commands[index], env)
 
-	return nil
+		// Services which are restarted because of changes start with the initial backoff again
+		f.backoffs[i], f.retries[i] = 0, 0
+
+		if err := f.startService(i); err != nil {
+			return err
+		}
+	}
+
+	return failures
+}
+
+// RunStages reruns the stages from index from up to (excluding) index to, even if they are skipped, while the services keep running.
+// If env is not nil, it replaces the env variables of the rerun stages; if one of them fails, a StageError is returned,
+// unless its failure is allowed, in which case the other stages are run and a StageFailuresError is returned.
+func (f *CommandFlow) RunStages(from, to int, env []string) error {
+	if from < 0 {
+		from = 0
+	}
+	if to > f.firstService() {
+		to = f.firstService()
+	}
+
+	return f.rerunStages(from, to, env, true)
+}
+
+// SetSkipped sets whether the stage at index stage is skipped when the flow is started or restarted
+func (f *CommandFlow) SetSkipped(stage int, skipped bool) {
+	f.commandsLock.Lock()
+	defer f.commandsLock.Unlock()
+
+	f.skipped[stage] = skipped
+}
+
+func (f *CommandFlow) isSkipped(stage int) bool {
+	f.commandsLock.Lock()
+	defer f.commandsLock.Unlock()
+
+	return f.skipped[stage]
+}
+
+// SetDebug sets whether the services with a debugger are launched under it; it takes effect once they are (re)started
+func (f *CommandFlow) SetDebug(debug bool) {
+	f.commandsLock.Lock()
+	defer f.commandsLock.Unlock()
+
+	f.debug = debug
+}
+
+// SetAllowFailure sets whether the flow continues if the stage at index stage fails, e.g. for tests which shouldn't stop the app from being restarted
+func (f *CommandFlow) SetAllowFailure(stage int, allowFailure bool) {
+	f.commandsLock.Lock()
+	defer f.commandsLock.Unlock()
+
+	f.allowedFailures[stage] = allowFailure
+}
+
+func (f *CommandFlow) isFailureAllowed(stage int) bool {
+	f.commandsLock.Lock()
+	defer f.commandsLock.Unlock()
+
+	return f.allowedFailures[stage]
+}
+
+// CommandStatus is the status of a stage or service of a CommandFlow
+type CommandStatus struct {
+	ExecLine string `json:"execLine"`
+	// Service is the name of the service if the command is a service
+	Service   string `json:"service,omitempty"`
+	IsService bool   `json:"isService"`
+	Skipped   bool   `json:"skipped"`
+	// AllowFailure is set if the flow continues when the stage fails
+	AllowFailure bool   `json:"allowFailure"`
+	Running      bool   `json:"running"`
+	ExitStatus   string `json:"exitStatus"`
+	// Retries is the number of times a service has been restarted since it has been started or restarted because of changes
+	Retries int `json:"retries"`
+	// Debugging is set if the service has been launched under its debugger
+	Debugging bool `json:"debugging"`
+}
+
+// GetStatus returns the status of the stages and services of the flow
+func (f *CommandFlow) GetStatus() []CommandStatus {
+	f.commandsLock.Lock()
+	defer f.commandsLock.Unlock()
+
+	var statuses []CommandStatus
+	for i, command := range f.commands {
+		status := CommandStatus{
+			ExecLine:     command.GetExecLine(),
+			Skipped:      f.skipped[i],
+			AllowFailure: f.allowedFailures[i],
+			Running:      !command.IsStopped(),
+			ExitStatus:   command.GetExitStatus(),
+		}
+
+		if service := i - f.firstService(); service >= 0 {
+			status.Service = f.services[service].Name
+			status.IsService = true
+			status.Retries = f.retries[service]
+			status.Debugging = f.services[service].Debugger != nil && command.GetExecLine() != f.services[service].Command
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses
 }
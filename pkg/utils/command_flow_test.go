@@ -1,7 +1,12 @@
 package utils
 
 import (
+	"io/ioutil"
 	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -123,3 +128,831 @@ func TestRestartCommandFlow(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestRestartFromCommandFlow(t *testing.T) {
+	logFile := filepath.Join(os.TempDir(), "dibs-command-flow-test.log")
+	if err := os.RemoveAll(logFile); err != nil {
+		t.Fatal(err)
+	}
+
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+	go func() {
+		for {
+			select {
+			case stdout := <-stdoutChan:
+				t.Log("test stdout", stdout)
+			case stderr := <-stderrChan:
+				t.Error("error while executing command", stderr)
+			}
+		}
+	}()
+
+	f := NewCommandFlow([]string{
+		"echo generate >> " + logFile,
+		"echo \"build $" + ChangedFilesEnv + "\" >> " + logFile,
+		"sleep 60",
+	}, testDir, stdoutChan, stderrChan)
+
+	f.SetEnv([]string{ChangedFilesEnv + "=initial"})
+
+	if err := f.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.RestartFrom(1, []string{ChangedFilesEnv + "=main.go"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "generate\nbuild initial\nbuild main.go\n"; string(content) != expected {
+		t.Errorf("commands ran as %q, expected %q", content, expected)
+	}
+}
+
+func TestRestartFromFailingStageCommandFlow(t *testing.T) {
+	failFile := filepath.Join(os.TempDir(), "dibs-command-flow-test-fail")
+	if err := os.RemoveAll(failFile); err != nil {
+		t.Fatal(err)
+	}
+
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+	go func() {
+		for {
+			select {
+			case stdout := <-stdoutChan:
+				t.Log("test stdout", stdout)
+			case stderr := <-stderrChan:
+				t.Log("test stderr", stderr)
+			}
+		}
+	}()
+
+	f := NewCommandFlow([]string{
+		"true",
+		"test ! -f " + failFile,
+		"sleep 60",
+	}, testDir, stdoutChan, stderrChan)
+
+	if err := f.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Stop()
+
+	app := f.commands[2]
+
+	if err := ioutil.WriteFile(failFile, []byte{}, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	err := f.RestartFrom(1, nil)
+
+	stageErr, ok := err.(*StageError)
+	if !ok {
+		t.Fatal("failing stage did not return a StageError", err)
+	}
+
+	if stageErr.Stage != 1 {
+		t.Error("wrong stage failed", stageErr.Stage)
+	}
+
+	if f.commands[2] != app || app.IsStopped() {
+		t.Error("app has been stopped although the restart failed")
+	}
+
+	if err := os.Remove(failFile); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.RestartFrom(1, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if f.commands[2] == app || f.commands[2].IsStopped() {
+		t.Error("app has not been restarted")
+	}
+
+	if f.commands[0].GetExecLine() != "true" || len(f.commands) != 3 {
+		t.Error("commands of earlier stages have not been kept")
+	}
+}
+
+func TestGetRestartStage(t *testing.T) {
+	stages := []string{"generateSources", "build", "unitTests", "start"}
+	rules := []StageRule{
+		{Pattern: "*.proto", Stage: "generateSources"},
+		{Pattern: "*.go", Stage: "build"},
+		{Pattern: "*_test.go", Stage: "unitTests"},
+		{Pattern: "/static/", Stage: "start"},
+		{Pattern: "*.sql", Stage: "integrationTests"},
+	}
+
+	tests := []struct {
+		changedFiles []string
+		expected     int
+	}{
+		{[]string{"main.go"}, 1},
+		{[]string{"main_test.go"}, 2},
+		{[]string{"static/index.html"}, 3},
+		{[]string{"static/index.html", "pkg/main.go"}, 1},
+		{[]string{"main.go", "api/api.proto"}, 0},
+		{[]string{"README.md"}, 0},
+		{[]string{"schema.sql"}, 0},
+		{nil, 0},
+	}
+
+	for _, test := range tests {
+		var changedFiles []string
+		for _, changedFile := range test.changedFiles {
+			changedFiles = append(changedFiles, filepath.Join("/src", changedFile))
+		}
+
+		if actual := GetRestartStage("/src", changedFiles, rules, stages); actual != test.expected {
+			t.Errorf("GetRestartStage(%v) returned %v, expected %v", test.changedFiles, actual, test.expected)
+		}
+	}
+
+	if actual := GetRestartStage("/src", []string{"/src/main.go"}, nil, stages); actual != 0 {
+		t.Error("flow without rules does not rerun all stages", actual)
+	}
+}
+
+func TestServiceCommandFlow(t *testing.T) {
+	logFile := filepath.Join(os.TempDir(), "dibs-command-flow-service-test.log")
+	if err := os.RemoveAll(logFile); err != nil {
+		t.Fatal(err)
+	}
+
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+	stdout := make(chan string, 10)
+	go func() {
+		for {
+			select {
+			case line := <-stdoutChan:
+				stdout <- line
+			case stderr := <-stderrChan:
+				t.Log("test stderr", stderr)
+			}
+		}
+	}()
+
+	f, err := NewServiceCommandFlow([]string{"true"}, []Service{
+		{Name: "api", Command: "echo api >> " + logFile + " && echo ready && sleep 60", DependsOn: []string{"db"}, RestartOnChange: true},
+		{Name: "db", Command: "echo db >> " + logFile + " && sleep 60"},
+	}, testDir, stdoutChan, stderrChan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Stop()
+
+	if line := <-stdout; line != "[api] ready" {
+		t.Errorf("service logged %q, expected %q", line, "[api] ready")
+	}
+
+	db := f.commands[1]
+	if !strings.HasPrefix(db.GetExecLine(), "echo db") {
+		t.Error("service has been started before the services it depends on")
+	}
+
+	if err := f.RestartFrom(0, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	<-stdout
+
+	if f.commands[1] != db || db.IsStopped() {
+		t.Error("service without restartOnChange has been restarted")
+	}
+
+	content, err := ioutil.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Count(string(content), "db\n") != 1 || strings.Count(string(content), "api\n") != 2 {
+		t.Errorf("services started as %q, expected db once and api twice", content)
+	}
+}
+
+func TestServiceCommandFlowDependencies(t *testing.T) {
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+
+	if _, err := NewServiceCommandFlow(nil, []Service{
+		{Name: "api", DependsOn: []string{"db"}},
+	}, testDir, stdoutChan, stderrChan); err == nil {
+		t.Error("unknown dependency did not return an error")
+	}
+
+	if _, err := NewServiceCommandFlow(nil, []Service{
+		{Name: "api", DependsOn: []string{"db"}},
+		{Name: "db", DependsOn: []string{"api"}},
+	}, testDir, stdoutChan, stderrChan); err == nil {
+		t.Error("circular dependency did not return an error")
+	}
+
+	if _, err := NewServiceCommandFlow(nil, []Service{
+		{Name: "api"},
+		{Name: "api"},
+	}, testDir, stdoutChan, stderrChan); err == nil {
+		t.Error("duplicate service did not return an error")
+	}
+}
+
+func TestServiceCommandFlowProbes(t *testing.T) {
+	logFile := filepath.Join(os.TempDir(), "dibs-command-flow-probe-test.log")
+	if err := os.RemoveAll(logFile); err != nil {
+		t.Fatal(err)
+	}
+
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+	stdout, stderr := make(chan string, 10), make(chan string, 10)
+	go func() {
+		for {
+			select {
+			case line := <-stdoutChan:
+				stdout <- line
+			case line := <-stderrChan:
+				stderr <- line
+			}
+		}
+	}()
+
+	f, err := NewServiceCommandFlow(nil, []Service{
+		{
+			Name:      "db",
+			Command:   "sleep 0.2 && echo db >> " + logFile + " && echo accepting connections && sleep 60",
+			Readiness: &Probe{Log: "accepting connections", Interval: time.Millisecond * 50},
+		},
+		{
+			Name:      "api",
+			Command:   "echo api >> " + logFile + " && sleep 0.2",
+			DependsOn: []string{"db"},
+			Liveness:  &Probe{Exec: "true", Interval: time.Millisecond * 50},
+			// The service exits after it has been started, so it is restarted repeatedly
+			RestartPolicy: RestartPolicyAlways,
+		},
+	}, testDir, stdoutChan, stderrChan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Stop()
+
+	for _, expected := range []string{"[db] accepting connections", "[db] Service is ready after"} {
+		if line := <-stdout; !strings.HasPrefix(line, expected) {
+			t.Errorf("service logged %q, expected %q", line, expected)
+		}
+	}
+
+	if line, expected := <-stderr, "[api] Service exited (exit status 0), restarting it in "+DefaultRestartBackoff.String()+" (retry 1)"; line != expected {
+		t.Errorf("service logged %q, expected %q", line, expected)
+	}
+
+	if line, expected := <-stderr, "[api] Service exited (exit status 0), restarting it in "+(DefaultRestartBackoff*2).String()+" (retry 2)"; line != expected {
+		t.Errorf("service logged %q, expected %q", line, expected)
+	}
+
+	content, err := ioutil.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "db\napi\napi\n"; string(content) != expected {
+		t.Errorf("services started as %q, expected %q", content, expected)
+	}
+}
+
+func TestServiceCommandFlowImmediateReadiness(t *testing.T) {
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+	ready, notReady := make(chan string, 10), make(chan string, 10)
+	go func() {
+		for {
+			select {
+			case line := <-stdoutChan:
+				if strings.Contains(line, "Service is ready") {
+					ready <- line
+				}
+			case line := <-stderrChan:
+				if strings.Contains(line, "Service is not ready") {
+					notReady <- line
+				}
+			}
+		}
+	}()
+
+	// The readiness line is logged right after the start, so it might be observed before the probe is checked for the first time
+	f, err := NewServiceCommandFlow(nil, []Service{{
+		Name:            "api",
+		Command:         "echo listening && sleep 60",
+		Readiness:       &Probe{Log: "listening", Interval: time.Millisecond * 10, FailureThreshold: 5},
+		RestartOnChange: true,
+	}}, testDir, stdoutChan, stderrChan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Stop()
+
+	for i := 0; i < 10; i++ {
+		select {
+		case <-ready:
+		case line := <-notReady:
+			t.Fatal("readiness line has been missed:", line)
+		case <-time.After(time.Second * 5):
+			t.Fatal("service has not become ready")
+		}
+
+		if err := f.RestartFrom(0, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestServiceCommandFlowInvalidProbe(t *testing.T) {
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+
+	if _, err := NewServiceCommandFlow(nil, []Service{
+		{Name: "api", Readiness: &Probe{}},
+	}, testDir, stdoutChan, stderrChan); err == nil {
+		t.Error("invalid probe did not return an error")
+	}
+}
+
+func TestServiceCommandFlowRestartPolicies(t *testing.T) {
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+	stdout, stderr := make(chan string, 10), make(chan string, 10)
+	go func() {
+		for {
+			select {
+			case line := <-stdoutChan:
+				stdout <- line
+			case line := <-stderrChan:
+				stderr <- line
+			}
+		}
+	}()
+
+	f, err := NewServiceCommandFlow(nil, []Service{
+		{Name: "never", Command: "exit 1"},
+		{Name: "on-failure", Command: "exit 0", RestartPolicy: RestartPolicyOnFailure},
+		{Name: "crashing", Command: "exit 2", RestartPolicy: RestartPolicyOnFailure, MaxRetries: 1, Backoff: time.Millisecond * 10},
+	}, testDir, stdoutChan, stderrChan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Stop()
+
+	expectedLines := map[string]bool{
+		"[on-failure] Service exited (exit status 0), not restarting it because of its restart policy on-failure": true,
+		"[crashing] Service exited (exit status 2), restarting it in 10ms (retry 1 of 1)":                         true,
+		"[crashing] Service exited (exit status 2), giving up after 1 retries":                                    true,
+	}
+
+	timeout := time.After(time.Second * 5)
+	for len(expectedLines) > 0 {
+		select {
+		case line := <-stdout:
+			if !expectedLines[line] {
+				t.Error("unexpected stdout", line)
+			}
+
+			delete(expectedLines, line)
+		case line := <-stderr:
+			if !expectedLines[line] {
+				t.Error("unexpected stderr", line)
+			}
+
+			delete(expectedLines, line)
+		case <-timeout:
+			t.Fatal("services did not log", expectedLines)
+		}
+	}
+
+	if _, err := NewServiceCommandFlow(nil, []Service{
+		{Name: "api", RestartPolicy: "sometimes"},
+	}, testDir, stdoutChan, stderrChan); err == nil {
+		t.Error("unknown restart policy did not return an error")
+	}
+}
+
+func TestSkippedStagesCommandFlow(t *testing.T) {
+	logFile := filepath.Join(os.TempDir(), "dibs-command-flow-skip-test.log")
+	if err := os.RemoveAll(logFile); err != nil {
+		t.Fatal(err)
+	}
+
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+	go func() {
+		for {
+			select {
+			case stdout := <-stdoutChan:
+				t.Log("test stdout", stdout)
+			case stderr := <-stderrChan:
+				t.Log("test stderr", stderr)
+			}
+		}
+	}()
+
+	f, err := NewServiceCommandFlow([]string{
+		"echo build >> " + logFile,
+		"echo test >> " + logFile,
+	}, []Service{{Command: "sleep 60", RestartOnChange: true}}, testDir, stdoutChan, stderrChan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.SetSkipped(1, true)
+
+	if err := f.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Stop()
+
+	app := f.commands[2]
+
+	if err := f.RestartFrom(0, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.RunStages(1, 2, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if f.commands[2] == app {
+		t.Error("service has not been restarted")
+	}
+	app = f.commands[2]
+
+	if err := f.RunStages(0, 3, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if f.commands[2] != app {
+		t.Error("service has been restarted while running stages")
+	}
+
+	content, err := ioutil.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "build\nbuild\ntest\nbuild\ntest\n"; string(content) != expected {
+		t.Errorf("stages ran as %q, expected %q", content, expected)
+	}
+
+	statuses := f.GetStatus()
+	if len(statuses) != 3 {
+		t.Fatal("status has", len(statuses), "commands, expected 3")
+	}
+
+	if !statuses[1].Skipped || statuses[0].Skipped || statuses[0].ExitStatus != "exit status 0" {
+		t.Error("status of stages is wrong", statuses[:2])
+	}
+
+	if !statuses[2].IsService || !statuses[2].Running {
+		t.Error("status of service is wrong", statuses[2])
+	}
+}
+
+func TestStopSkippedStagesCommandFlow(t *testing.T) {
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+	go func() {
+		for {
+			select {
+			case stdout := <-stdoutChan:
+				t.Log("test stdout", stdout)
+			case stderr := <-stderrChan:
+				t.Log("test stderr", stderr)
+			}
+		}
+	}()
+
+	f, err := NewServiceCommandFlow([]string{"true", "true"}, []Service{{Command: "sleep 60", RestartOnChange: true}}, testDir, stdoutChan, stderrChan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Stages which have never been started are stopped
+	f.SetSkipped(1, true)
+
+	if err := f.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	if status := f.GetStatus()[1]; status.Running || status.ExitStatus != "not started" {
+		t.Error("status of skipped stage is wrong", status)
+	}
+
+	if err := f.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Wait(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConcurrentStatusCommandFlow(t *testing.T) {
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+	go func() {
+		for {
+			select {
+			case stdout := <-stdoutChan:
+				t.Log("test stdout", stdout)
+			case stderr := <-stderrChan:
+				t.Log("test stderr", stderr)
+			}
+		}
+	}()
+
+	f, err := NewServiceCommandFlow([]string{"true"}, []Service{{Command: "exit 1", RestartPolicy: RestartPolicyOnFailure, Backoff: 10 * time.Millisecond}}, testDir, stdoutChan, stderrChan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Stop()
+
+	// The status is read while the service keeps exiting and the stage is toggled, e.g. by the dev API and the console
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		for i := 0; i < 100; i++ {
+			f.SetSkipped(0, i%2 == 0)
+			f.SetAllowFailure(0, i%2 == 0)
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		f.GetStatus()
+
+		time.Sleep(time.Millisecond)
+	}
+
+	<-done
+}
+
+func TestAllowFailureCommandFlow(t *testing.T) {
+	logFile := filepath.Join(os.TempDir(), "dibs-command-flow-allow-failure-test.log")
+	if err := os.RemoveAll(logFile); err != nil {
+		t.Fatal(err)
+	}
+
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+	go func() {
+		for {
+			select {
+			case stdout := <-stdoutChan:
+				t.Log("test stdout", stdout)
+			case stderr := <-stderrChan:
+				t.Log("test stderr", stderr)
+			}
+		}
+	}()
+
+	f, err := NewServiceCommandFlow([]string{
+		"echo build >> " + logFile,
+		"false",
+		"echo integration >> " + logFile,
+	}, []Service{{Command: "sleep 60", RestartOnChange: true}}, testDir, stdoutChan, stderrChan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.SetAllowFailure(1, true)
+
+	err = f.Start()
+	defer f.Stop()
+
+	failuresErr, ok := err.(*StageFailuresError)
+	if !ok {
+		t.Fatal("failing stage did not return a StageFailuresError", err)
+	}
+
+	if len(failuresErr.Failures) != 1 || failuresErr.Failures[0].Stage != 1 {
+		t.Error("wrong stages failed", failuresErr.Failures)
+	}
+
+	app := f.commands[3]
+	if app.IsStopped() {
+		t.Error("service has not been started although the failure is allowed")
+	}
+
+	if _, ok := f.RestartFrom(0, nil).(*StageFailuresError); !ok {
+		t.Error("failing stage did not return a StageFailuresError on restart")
+	}
+
+	if f.commands[3] == app || f.commands[3].IsStopped() {
+		t.Error("service has not been restarted although the failure is allowed")
+	}
+
+	if _, ok := f.RunStages(1, 3, nil).(*StageFailuresError); !ok {
+		t.Error("failing stage did not return a StageFailuresError when running stages")
+	}
+
+	content, err := ioutil.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "build\nintegration\nbuild\nintegration\nintegration\n"; string(content) != expected {
+		t.Errorf("stages ran as %q, expected %q", content, expected)
+	}
+
+	if statuses := f.GetStatus(); !statuses[1].AllowFailure || statuses[1].ExitStatus != "exit status 1" {
+		t.Error("status of failing stage is wrong", statuses[1])
+	}
+
+	f.SetAllowFailure(1, false)
+
+	if _, ok := f.RestartFrom(0, nil).(*StageError); !ok {
+		t.Error("failing stage did not return a StageError after disallowing its failure")
+	}
+}
+
+func TestDebugCommandFlow(t *testing.T) {
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+	debugging := make(chan string, 10)
+	go func() {
+		for {
+			select {
+			case stdout := <-stdoutChan:
+				t.Log("test stdout", stdout)
+
+				if strings.Contains(stdout, "debugging") {
+					debugging <- stdout
+				}
+			case stderr := <-stderrChan:
+				t.Log("test stderr", stderr)
+			}
+		}
+	}()
+
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	if err := listener.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := NewServiceCommandFlow(nil, []Service{{
+		Name:            "api",
+		Command:         "sleep 60",
+		RestartOnChange: true,
+		Debugger: &Debugger{
+			// The debugger cleans up when it is stopped
+			Command: "trap 'echo stopped debugging; exit 0' TERM; echo debugging {{.Asset}} on {{.Port}}; sleep 60 & wait",
+			Asset:   "api",
+			Port:    port,
+		},
+	}}, testDir, stdoutChan, stderrChan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Stop()
+
+	if f.GetStatus()[0].Debugging {
+		t.Error("service is debugging before debugging has been enabled")
+	}
+
+	f.SetDebug(true)
+
+	if err := f.RestartFrom(0, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case line := <-debugging:
+		if expected := "[api] debugging api on " + strconv.Itoa(port); line != expected {
+			t.Errorf("debugger logged %q, expected %q", line, expected)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("debugger has not been launched")
+	}
+
+	if !f.GetStatus()[0].Debugging {
+		t.Error("service is not debugging after debugging has been enabled")
+	}
+
+	f.SetDebug(false)
+
+	if err := f.RestartFrom(0, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case line := <-debugging:
+		if line != "[api] stopped debugging" {
+			t.Errorf("debugger logged %q, expected it to stop", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("debugger has not been stopped gracefully")
+	}
+
+	if status := f.GetStatus()[0]; status.Debugging || status.ExecLine != "sleep 60" {
+		t.Error("service is still debugging after debugging has been disabled", status)
+	}
+}
+
+func TestDebugCommandFlowPortInUse(t *testing.T) {
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+	debugging := make(chan string, 10)
+	go func() {
+		for {
+			select {
+			case stdout := <-stdoutChan:
+				t.Log("test stdout", stdout)
+
+				if strings.Contains(stdout, "debugging") {
+					debugging <- stdout
+				}
+			case stderr := <-stderrChan:
+				t.Log("test stderr", stderr)
+			}
+		}
+	}()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	f, err := NewServiceCommandFlow(nil, []Service{{
+		Name:    "api",
+		Command: "sleep 60",
+		Debugger: &Debugger{
+			Command: "echo debugging {{.Asset}}; sleep 60",
+			Asset:   "api",
+			Port:    listener.Addr().(*net.TCPAddr).Port,
+		},
+	}}, testDir, stdoutChan, stderrChan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.SetDebug(true)
+
+	if err := f.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Stop()
+
+	// The status must not block while the debugger waits for its port
+	statuses := make(chan []CommandStatus)
+	go func() {
+		statuses <- f.GetStatus()
+	}()
+
+	select {
+	case status := <-statuses:
+		if status[0].Running {
+			t.Error("debugger is running although its port is in use", status[0])
+		}
+	case <-time.After(time.Second):
+		t.Fatal("status is blocked while the debugger waits for its port")
+	}
+
+	if err := listener.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case line := <-debugging:
+		if expected := "[api] debugging api"; line != expected {
+			t.Errorf("debugger logged %q, expected %q", line, expected)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("debugger has not been launched once its port has been freed")
+	}
+}
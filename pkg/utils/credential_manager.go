@@ -0,0 +1,230 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CredentialSource references a secret; exactly one of Env, File, DotEnv or Command should be set
+type CredentialSource struct {
+	// Env is the name of the env variable which contains the secret
+	Env string
+	// File is the path of a file which contains the secret
+	File string
+	// DotEnv is the path of a `.env` file which contains the secret under Key
+	DotEnv string
+	// Key is the key of the secret in DotEnv; if it is empty, the name of the credential is used
+	Key string
+	// Command is a command which prints the secret, e.g. `pass show dibs/github-token`
+	Command string
+}
+
+// CredentialRequirement declares credentials which a stage uses.
+// Unless it is optional, at least one of its credentials must be set.
+type CredentialRequirement struct {
+	Names    []string
+	Optional bool
+}
+
+// Credentials maps the names of credentials to their secrets
+type Credentials map[string]string
+
+// Get returns the secret of a credential or an empty string if it has not been resolved
+func (c Credentials) Get(name string) string {
+	return c[name]
+}
+
+// MissingCredentialsError is returned if required credentials are not set or can't be resolved
+type MissingCredentialsError struct {
+	Missing []string
+}
+
+func (e *MissingCredentialsError) Error() string {
+	return "missing credentials:\n- " + strings.Join(e.Missing, "\n- ")
+}
+
+// CredentialManager manages credentials
+type CredentialManager struct {
+	dir                    string
+	stdoutChan, stderrChan chan string
+}
+
+// NewCredentialManager creates a new CredentialManager
+func NewCredentialManager(dir string, stdoutChan, stderrChan chan string) *CredentialManager {
+	return &CredentialManager{
+		dir:        dir,
+		stdoutChan: stdoutChan,
+		stderrChan: stderrChan,
+	}
+}
+
+func (c *CredentialManager) getPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(c.dir, path)
+}
+
+// ParseDotEnv parses the content of a `.env` file
+func ParseDotEnv(content []byte) (map[string]string, error) {
+	values := map[string]string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		entry = strings.TrimPrefix(entry, "export ")
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("invalid line " + strconv.Itoa(line) + " in .env file: expected KEY=VALUE")
+		}
+
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+
+		values[key] = value
+	}
+
+	return values, scanner.Err()
+}
+
+// Resolve returns the secret of a credential; an empty string means that the source does not contain it
+func (c *CredentialManager) Resolve(name string, source CredentialSource) (string, error) {
+	switch {
+	case source.Env != "":
+		return os.Getenv(source.Env), nil
+	case source.File != "":
+		content, err := ioutil.ReadFile(c.getPath(source.File))
+		if err != nil {
+			return "", err
+		}
+
+		return strings.TrimRight(string(content), "\r\n"), nil
+	case source.DotEnv != "":
+		content, err := ioutil.ReadFile(c.getPath(source.DotEnv))
+		if err != nil {
+			return "", err
+		}
+
+		values, err := ParseDotEnv(content)
+		if err != nil {
+			return "", err
+		}
+
+		key := source.Key
+		if key == "" {
+			key = name
+		}
+
+		return values[key], nil
+	case source.Command != "":
+		var stdout, stderr bytes.Buffer
+
+		command := getCommandWrappedInSh(source.Command)
+		command.Dir = c.dir
+		command.Stdout = &stdout
+		command.Stderr = &stderr
+
+		if err := command.Run(); err != nil {
+			return "", errors.New(err.Error() + ": " + strings.TrimSpace(stderr.String()))
+		}
+
+		return strings.TrimRight(stdout.String(), "\r\n"), nil
+	default:
+		return "", nil
+	}
+}
+
+// ResolveAll resolves the credentials of all requirements and returns a MissingCredentialsError listing all required credentials which are not set
+func (c *CredentialManager) ResolveAll(sources map[string]CredentialSource, requirements []CredentialRequirement) (Credentials, error) {
+	credentials := Credentials{}
+	failures := map[string]string{}
+
+	for _, requirement := range requirements {
+		for _, name := range requirement.Names {
+			if _, ok := credentials[name]; ok {
+				continue
+			}
+
+			secret, err := c.Resolve(name, sources[name])
+			if err != nil {
+				failures[name] = err.Error()
+
+				continue
+			}
+
+			credentials[name] = secret
+		}
+	}
+
+	// Credentials which are configured but can't be resolved are reported even if they are optional
+	missing := map[string]bool{}
+	for name, failure := range failures {
+		missing[name+" ("+failure+")"] = true
+	}
+
+	for _, requirement := range requirements {
+		if requirement.Optional {
+			continue
+		}
+
+		isSet := false
+		for _, name := range requirement.Names {
+			if credentials[name] != "" {
+				isSet = true
+			}
+		}
+
+		if isSet {
+			continue
+		}
+
+		var reasons []string
+		for _, name := range requirement.Names {
+			if _, ok := failures[name]; ok {
+				continue
+			}
+
+			reason := name
+			if source := sources[name]; source.Env != "" {
+				reason += " (env variable " + source.Env + " is not set)"
+			} else if source.DotEnv != "" {
+				reason += " (not set in " + source.DotEnv + ")"
+			} else {
+				reason += " (not set)"
+			}
+
+			reasons = append(reasons, reason)
+		}
+
+		if len(reasons) > 0 {
+			missing[strings.Join(reasons, " or ")] = true
+		}
+	}
+
+	if len(missing) > 0 {
+		err := &MissingCredentialsError{}
+		for reason := range missing {
+			err.Missing = append(err.Missing, reason)
+		}
+		sort.Strings(err.Missing)
+
+		return nil, err
+	}
+
+	return credentials, nil
+}
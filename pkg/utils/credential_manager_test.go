@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var (
+	testCredentialDir = filepath.Join(os.TempDir(), "dibs-credential-test")
+)
+
+func setupCredentialTest(t *testing.T) {
+	if err := os.RemoveAll(testCredentialDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(testCredentialDir, 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(testCredentialDir, "token"), []byte("file-secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(testCredentialDir, ".env"), []byte(`# Secrets
+export DIBS_GITHUB_TOKEN="dotenv-secret"
+ociPassword='quoted secret'
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreateCredentialManager(t *testing.T) {
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+
+	c := NewCredentialManager(testContext, stdoutChan, stderrChan)
+
+	if c == nil {
+		t.Error("New credential manager is nil")
+	}
+
+	if c.dir != testContext {
+		t.Error("dir not set correctly")
+	}
+
+	if c.stdoutChan != stdoutChan {
+		t.Error("stdoutChan not set correctly")
+	}
+
+	if c.stderrChan != stderrChan {
+		t.Error("stderrChan not correctly")
+	}
+}
+
+func TestParseDotEnv(t *testing.T) {
+	values, err := ParseDotEnv([]byte("A=1\n\n# comment\nexport B = \"two words\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if values["A"] != "1" || values["B"] != "two words" {
+		t.Error("values not parsed correctly", values)
+	}
+
+	if _, err := ParseDotEnv([]byte("A=1\nINVALID\n")); err == nil {
+		t.Error("invalid line did not return an error")
+	}
+}
+
+func TestResolveCredentialManager(t *testing.T) {
+	setupCredentialTest(t)
+
+	if err := os.Setenv("DIBS_TEST_CREDENTIAL", "env-secret"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv("DIBS_TEST_CREDENTIAL")
+
+	c := NewCredentialManager(testCredentialDir, make(chan string), make(chan string))
+
+	tests := []struct {
+		name, expected string
+		source         CredentialSource
+	}{
+		{"env", "env-secret", CredentialSource{Env: "DIBS_TEST_CREDENTIAL"}},
+		{"file", "file-secret", CredentialSource{File: "token"}},
+		{"dotenv", "dotenv-secret", CredentialSource{DotEnv: ".env", Key: "DIBS_GITHUB_TOKEN"}},
+		{"ociPassword", "quoted secret", CredentialSource{DotEnv: ".env"}},
+		{"command", "command-secret", CredentialSource{Command: "echo command-secret"}},
+		{"unset", "", CredentialSource{}},
+	}
+
+	for _, test := range tests {
+		secret, err := c.Resolve(test.name, test.source)
+		if err != nil {
+			t.Error(test.name, err)
+		}
+
+		if secret != test.expected {
+			t.Errorf("%v resolved to %q, expected %q", test.name, secret, test.expected)
+		}
+	}
+
+	if _, err := c.Resolve("command", CredentialSource{Command: "echo failed >&2 && false"}); err == nil || !strings.Contains(err.Error(), "failed") {
+		t.Error("failing command did not return its stderr", err)
+	}
+}
+
+func TestResolveAllCredentialManager(t *testing.T) {
+	setupCredentialTest(t)
+
+	c := NewCredentialManager(testCredentialDir, make(chan string), make(chan string))
+
+	sources := map[string]CredentialSource{
+		"githubToken":    {File: "token"},
+		"signingKey":     {Env: "DIBS_TEST_UNSET_SIGNING_KEY"},
+		"signingGPGKey":  {Env: "DIBS_TEST_UNSET_SIGNING_GPG_KEY"},
+		"ociPassword":    {DotEnv: ".env"},
+		"gitPassword":    {File: "does-not-exist"},
+		"sshKeyPassword": {Env: "DIBS_TEST_UNSET_SSH_KEY_PASSWORD"},
+	}
+
+	credentials, err := c.ResolveAll(sources, []CredentialRequirement{
+		{Names: []string{"githubToken"}},
+		{Names: []string{"ociPassword"}, Optional: true},
+		{Names: []string{"sshKeyPassword"}, Optional: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if credentials.Get("githubToken") != "file-secret" || credentials.Get("ociPassword") != "quoted secret" || credentials.Get("sshKeyPassword") != "" {
+		t.Error("credentials not resolved correctly", credentials)
+	}
+
+	_, err = c.ResolveAll(sources, []CredentialRequirement{
+		{Names: []string{"githubToken"}},
+		{Names: []string{"signingKey", "signingGPGKey"}},
+		{Names: []string{"gitPassword"}, Optional: true},
+	})
+
+	missingErr, ok := err.(*MissingCredentialsError)
+	if !ok {
+		t.Fatal("missing credentials did not return a MissingCredentialsError", err)
+	}
+
+	if len(missingErr.Missing) != 2 {
+		t.Fatal("not all missing credentials were listed", missingErr.Missing)
+	}
+
+	if !strings.HasPrefix(missingErr.Missing[0], "gitPassword (") {
+		t.Error("unreadable optional credential not listed", missingErr.Missing[0])
+	}
+
+	if !strings.Contains(missingErr.Missing[1], "signingKey (env variable DIBS_TEST_UNSET_SIGNING_KEY is not set) or signingGPGKey") {
+		t.Error("alternative credentials not listed", missingErr.Missing[1])
+	}
+}
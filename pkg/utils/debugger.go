@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	// DebuggerDelve launches the asset under Delve (https://github.com/go-delve/delve)
+	DebuggerDelve = "delve"
+	// DefaultDebugHost is the address the debugger listens on if none is set; the debuggers allow clients to run code, so they are only reachable locally
+	DefaultDebugHost = "127.0.0.1"
+	// DefaultDebugPort is the port the debugger listens on if none is set
+	DefaultDebugPort = 31441
+	// DefaultDebuggerStopTimeout is the time the debugger is given to stop the debugged asset before it is killed
+	DefaultDebuggerStopTimeout = 5 * time.Second
+
+	debugPortWaitTimeout = 10 * time.Second
+)
+
+// Debugger launches the asset of a service under a debugger which listens on a port
+type Debugger struct {
+	// Name is the name of a supported debugger, e.g. DebuggerDelve; if it is empty, Command is used
+	Name string
+	// Command is a template of the command which launches the asset under a custom debugger,
+	// e.g. `gdbserver {{.Host}}:{{.Port}} {{.Asset}} {{.Args}}`; the asset and args are quoted for the shell
+	Command string
+	// Asset is the path of the built asset to debug
+	Asset string
+	// Args are passed to the asset
+	Args []string
+	// Host is the address the debugger listens on; defaults to DefaultDebugHost, e.g. 0.0.0.0 makes it reachable from outside of a dev container
+	Host string
+	// Port is the port the debugger listens on; defaults to DefaultDebugPort
+	Port int
+}
+
+type debuggerTemplateData struct {
+	Asset string
+	Args  string
+	Host  string
+	Port  int
+}
+
+// quoteShellArg quotes arg so that it is passed as one argument by `sh`
+func quoteShellArg(arg string) string {
+	return "'" + strings.ReplaceAll(arg, "'", `'"'"'`) + "'"
+}
+
+// GetHost returns the address the debugger listens on
+func (d *Debugger) GetHost() string {
+	if d.Host == "" {
+		return DefaultDebugHost
+	}
+
+	return d.Host
+}
+
+// GetPort returns the port the debugger listens on
+func (d *Debugger) GetPort() int {
+	if d.Port <= 0 {
+		return DefaultDebugPort
+	}
+
+	return d.Port
+}
+
+// GetExecLine returns the command which launches the asset under the debugger
+func (d *Debugger) GetExecLine() (string, error) {
+	if d.Asset == "" {
+		return "", errors.New("debuggers need an asset to debug")
+	}
+
+	var args []string
+	for _, arg := range d.Args {
+		args = append(args, quoteShellArg(arg))
+	}
+
+	switch d.Name {
+	case DebuggerDelve:
+		// The asset is continued right away, so that it behaves like it does without the debugger until a client sets breakpoints
+		execLine := "dlv exec " + quoteShellArg(d.Asset) + " --headless --listen=" + quoteShellArg(d.getListenAddress()) + " --api-version=2 --accept-multiclient --continue"
+		if len(args) > 0 {
+			execLine += " -- " + strings.Join(args, " ")
+		}
+
+		return execLine, nil
+	case "":
+		if d.Command == "" {
+			return "", errors.New("custom debuggers need a command")
+		}
+
+		tmpl, err := template.New("debugger").Parse(d.Command)
+		if err != nil {
+			return "", err
+		}
+
+		execLine := &bytes.Buffer{}
+		if err := tmpl.Execute(execLine, debuggerTemplateData{
+			Asset: quoteShellArg(d.Asset),
+			Args:  strings.Join(args, " "),
+			Host:  d.GetHost(),
+			Port:  d.GetPort(),
+		}); err != nil {
+			return "", err
+		}
+
+		return execLine.String(), nil
+	default:
+		return "", errors.New("unknown debugger " + d.Name + ", use " + DebuggerDelve + " or set a command")
+	}
+}
+
+func (d *Debugger) getListenAddress() string {
+	return net.JoinHostPort(d.GetHost(), strconv.Itoa(d.GetPort()))
+}
+
+// getDialAddress returns the address on which the debugger can be reached locally
+func (d *Debugger) getDialAddress() string {
+	host := d.GetHost()
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(d.GetPort()))
+}
+
+// waitForPort waits until the debugger's port is free, e.g. because the debugger of a previous run is still stopping, or until timeout has passed
+func (d *Debugger) waitForPort(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		listener, err := net.Listen("tcp", d.getListenAddress())
+		if err == nil {
+			return listener.Close()
+		}
+
+		if time.Now().After(deadline) {
+			return errors.New("debug port " + strconv.Itoa(d.GetPort()) + " is still in use after " + timeout.String() + ": " + err.Error())
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+}
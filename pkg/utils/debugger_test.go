@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDelveDebugger(t *testing.T) {
+	d := &Debugger{Name: DebuggerDelve, Asset: ".bin/test app", Args: []string{"-name", "it's me"}}
+
+	execLine, err := d.GetExecLine()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := `dlv exec '.bin/test app' --headless --listen='127.0.0.1:31441' --api-version=2 --accept-multiclient --continue -- '-name' 'it'"'"'s me'`; execLine != expected {
+		t.Errorf("exec line is %q, expected %q", execLine, expected)
+	}
+
+	d.Host, d.Port = "0.0.0.0", 2345
+
+	execLine, err = d.GetExecLine()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(execLine, "--listen='0.0.0.0:2345'") || d.getDialAddress() != "localhost:2345" {
+		t.Errorf("exec line is %q and dial address is %q for host %v", execLine, d.getDialAddress(), d.Host)
+	}
+}
+
+func TestCustomDebugger(t *testing.T) {
+	d := &Debugger{Command: "gdbserver {{.Host}}:{{.Port}} {{.Asset}} {{.Args}}", Asset: ".bin/test-app", Args: []string{"-verbose"}, Port: 2345}
+
+	execLine, err := d.GetExecLine()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := `gdbserver 127.0.0.1:2345 '.bin/test-app' '-verbose'`; execLine != expected {
+		t.Errorf("exec line is %q, expected %q", execLine, expected)
+	}
+
+	for _, invalid := range []*Debugger{
+		{Name: "gdb", Asset: ".bin/test-app"},
+		{Name: DebuggerDelve},
+		{Asset: ".bin/test-app"},
+		{Command: "gdbserver {{.Asset", Asset: ".bin/test-app"},
+	} {
+		if _, err := invalid.GetExecLine(); err == nil {
+			t.Errorf("invalid debugger %+v did not return an error", invalid)
+		}
+	}
+}
+
+func TestDebuggerWaitForPort(t *testing.T) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &Debugger{Port: listener.Addr().(*net.TCPAddr).Port}
+
+	if err := d.waitForPort(200 * time.Millisecond); err == nil {
+		t.Error("waiting for port " + strconv.Itoa(d.Port) + " succeeded although it is in use")
+	}
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+
+		_ = listener.Close()
+	}()
+
+	if err := d.waitForPort(5 * time.Second); err != nil {
+		t.Error("waiting for port failed although it has been freed", err)
+	}
+}
@@ -0,0 +1,294 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DevAPIUnixPrefix is the prefix of dev API addresses which are unix sockets, e.g. `unix:/tmp/dibs.sock`
+	DevAPIUnixPrefix = "unix:"
+
+	// DevAPIHeader must be set on requests which change the dev flow; browsers can't send it cross-site without a CORS preflight, which the API doesn't allow,
+	// so web pages can't restart or stop the flow
+	DevAPIHeader = "X-Dibs-Dev-API"
+	// devAPIDefaultHost is the host which addresses without a host listen on, so that the API is not exposed to the network
+	devAPIDefaultHost = "127.0.0.1"
+
+	// StdoutStream is the stream of log lines which have been written to stdout
+	StdoutStream = "stdout"
+	// StderrStream is the stream of log lines which have been written to stderr
+	StderrStream = "stderr"
+
+	devAPILogBuffer = 100
+)
+
+var (
+	// ErrUnknownStage is returned by the restart handler of a DevAPIServer if the stage does not exist
+	ErrUnknownStage = errors.New("unknown stage")
+)
+
+// DevStageStatus is the status of a stage or service of the dev flow
+type DevStageStatus struct {
+	Stage string `json:"stage"`
+	CommandStatus
+}
+
+// DevLogLine is a line which a command of the dev flow has logged
+type DevLogLine struct {
+	Time   time.Time `json:"time"`
+	Stream string    `json:"stream"`
+	Line   string    `json:"line"`
+}
+
+type devAPIError struct {
+	Error string `json:"error"`
+}
+
+// DevAPIServer exposes the dev flow over a local HTTP/JSON API:
+//
+//	GET  /status           returns the status of all stages and services
+//	POST /restart?stage=x  restarts the flow from stage x (or from the first stage) and returns once it has restarted
+//	GET  /logs             streams the log lines of the flow as server-sent events
+//	POST /stop             stops the flow
+//
+// The POST endpoints require the DevAPIHeader to be set.
+type DevAPIServer struct {
+	address   string
+	getStatus func() []DevStageStatus
+	restart   func(stage string) error
+	stop      func()
+
+	listener    net.Listener
+	server      *http.Server
+	subscribers map[chan DevLogLine]struct{}
+	lock        sync.Mutex
+}
+
+// NewDevAPIServer creates a new DevAPIServer which listens on address; addresses with the DevAPIUnixPrefix are unix sockets and addresses without a host, e.g. `:31442`, listen on localhost
+func NewDevAPIServer(address string, getStatus func() []DevStageStatus, restart func(stage string) error, stop func()) *DevAPIServer {
+	return &DevAPIServer{
+		address:     address,
+		getStatus:   getStatus,
+		restart:     restart,
+		stop:        stop,
+		subscribers: map[chan DevLogLine]struct{}{},
+	}
+}
+
+// Start starts listening and serves the API in a new goroutine
+func (s *DevAPIServer) Start() error {
+	network, address := getDevAPINetwork(s.address)
+	if network == "unix" {
+		// Sockets of previous runs which have not been stopped gracefully would prevent listening
+		if info, err := os.Stat(address); err == nil && info.Mode()&os.ModeSocket != 0 {
+			if err := os.Remove(address); err != nil {
+				return err
+			}
+		}
+	}
+
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/restart", s.handleRestart)
+	mux.HandleFunc("/logs", s.handleLogs)
+	mux.HandleFunc("/stop", s.handleStop)
+
+	s.lock.Lock()
+	s.listener = listener
+	s.server = &http.Server{Handler: mux}
+	s.lock.Unlock()
+
+	go func() {
+		_ = s.server.Serve(listener)
+	}()
+
+	return nil
+}
+
+// Addr returns the address the DevAPIServer is listening on
+func (s *DevAPIServer) Addr() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.listener == nil {
+		return s.address
+	}
+
+	if s.listener.Addr().Network() == "unix" {
+		return DevAPIUnixPrefix + s.listener.Addr().String()
+	}
+
+	return s.listener.Addr().String()
+}
+
+// Publish sends a log line to all clients which are streaming the logs; clients which are too slow miss lines
+func (s *DevAPIServer) Publish(stream, line string) {
+	logLine := DevLogLine{
+		Time:   time.Now(),
+		Stream: stream,
+		Line:   line,
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for subscriber := range s.subscribers {
+		select {
+		case subscriber <- logLine:
+		default:
+		}
+	}
+}
+
+// Stop stops the DevAPIServer and closes all log streams
+func (s *DevAPIServer) Stop() error {
+	s.lock.Lock()
+	server := s.server
+	s.lock.Unlock()
+
+	if server == nil {
+		return nil
+	}
+
+	// Log streams never end, so they are not waited for
+	return server.Close()
+}
+
+func getDevAPINetwork(address string) (string, string) {
+	if strings.HasPrefix(address, DevAPIUnixPrefix) {
+		return "unix", strings.TrimPrefix(strings.TrimPrefix(address, DevAPIUnixPrefix), "//")
+	}
+
+	if host, port, err := net.SplitHostPort(address); err == nil && host == "" {
+		address = net.JoinHostPort(devAPIDefaultHost, port)
+	}
+
+	return "tcp", address
+}
+
+func writeDevAPIJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func writeDevAPIError(w http.ResponseWriter, status int, err error) {
+	writeDevAPIJSON(w, status, devAPIError{Error: err.Error()})
+}
+
+// checkDevAPIRequest writes an error and returns false if r does not use method or if it changes the flow without the DevAPIHeader
+func checkDevAPIRequest(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		writeDevAPIError(w, http.StatusMethodNotAllowed, errors.New("use "+method))
+
+		return false
+	}
+
+	if method != http.MethodGet && r.Header.Get(DevAPIHeader) == "" {
+		writeDevAPIError(w, http.StatusForbidden, errors.New("set the "+DevAPIHeader+" header to change the dev flow"))
+
+		return false
+	}
+
+	return true
+}
+
+func (s *DevAPIServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if !checkDevAPIRequest(w, r, http.MethodGet) {
+		return
+	}
+
+	writeDevAPIJSON(w, http.StatusOK, s.getStatus())
+}
+
+func (s *DevAPIServer) handleRestart(w http.ResponseWriter, r *http.Request) {
+	if !checkDevAPIRequest(w, r, http.MethodPost) {
+		return
+	}
+
+	if err := s.restart(r.URL.Query().Get("stage")); err != nil {
+		if errors.Is(err, ErrUnknownStage) {
+			writeDevAPIError(w, http.StatusBadRequest, err)
+
+			return
+		}
+
+		// The stage has failed, so the services are still running
+		writeDevAPIError(w, http.StatusUnprocessableEntity, err)
+
+		return
+	}
+
+	writeDevAPIJSON(w, http.StatusOK, s.getStatus())
+}
+
+func (s *DevAPIServer) handleLogs(w http.ResponseWriter, r *http.Request) {
+	if !checkDevAPIRequest(w, r, http.MethodGet) {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeDevAPIError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+
+		return
+	}
+
+	subscriber := make(chan DevLogLine, devAPILogBuffer)
+
+	s.lock.Lock()
+	s.subscribers[subscriber] = struct{}{}
+	s.lock.Unlock()
+
+	defer func() {
+		s.lock.Lock()
+		delete(s.subscribers, subscriber)
+		s.lock.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case logLine := <-subscriber:
+			data, err := json.Marshal(logLine)
+			if err != nil {
+				return
+			}
+
+			if _, err := w.Write([]byte("data: " + string(data) + "\n\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *DevAPIServer) handleStop(w http.ResponseWriter, r *http.Request) {
+	if !checkDevAPIRequest(w, r, http.MethodPost) {
+		return
+	}
+
+	writeDevAPIJSON(w, http.StatusAccepted, struct{}{})
+
+	// The flow is stopped after the response has been sent, as stopping it might exit the process
+	go s.stop()
+}
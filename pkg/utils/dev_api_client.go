@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DevAPIClient is a client for a DevAPIServer
+type DevAPIClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewDevAPIClient creates a new DevAPIClient for the DevAPIServer at address; addresses with the DevAPIUnixPrefix are unix sockets
+func NewDevAPIClient(address string) *DevAPIClient {
+	network, address := getDevAPINetwork(address)
+
+	if network == "unix" {
+		return &DevAPIClient{
+			// The host is ignored, as all requests are sent to the socket
+			baseURL: "http://dibs",
+			client: &http.Client{
+				Transport: &http.Transport{
+					DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+						return (&net.Dialer{}).DialContext(ctx, "unix", address)
+					},
+				},
+			},
+		}
+	}
+
+	return &DevAPIClient{
+		baseURL: "http://" + address,
+		client:  &http.Client{},
+	}
+}
+
+func (c *DevAPIClient) do(method, path string, out interface{}) error {
+	req, err := http.NewRequest(method, c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(DevAPIHeader, "true")
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		var apiErr devAPIError
+		if err := json.NewDecoder(res.Body).Decode(&apiErr); err != nil || apiErr.Error == "" {
+			return errors.New(method + " " + path + " returned status " + res.Status)
+		}
+
+		return errors.New(apiErr.Error)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// GetStatus returns the status of all stages and services of the dev flow
+func (c *DevAPIClient) GetStatus() ([]DevStageStatus, error) {
+	var statuses []DevStageStatus
+	if err := c.do(http.MethodGet, "/status", &statuses); err != nil {
+		return nil, err
+	}
+
+	return statuses, nil
+}
+
+// Restart restarts the dev flow from stage (or from the first stage if stage is empty) and returns the status once it has restarted
+func (c *DevAPIClient) Restart(stage string) ([]DevStageStatus, error) {
+	path := "/restart"
+	if stage != "" {
+		path += "?stage=" + url.QueryEscape(stage)
+	}
+
+	var statuses []DevStageStatus
+	if err := c.do(http.MethodPost, path, &statuses); err != nil {
+		return nil, err
+	}
+
+	return statuses, nil
+}
+
+// Stop stops the dev flow
+func (c *DevAPIClient) Stop() error {
+	return c.do(http.MethodPost, "/stop", nil)
+}
+
+// StreamLogs sends the log lines of the dev flow to logChan until ctx is done or the stream ends
+func (c *DevAPIClient) StreamLogs(ctx context.Context, logChan chan DevLogLine) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/logs", nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return errors.New("GET /logs returned status " + res.Status)
+	}
+
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		data := strings.TrimPrefix(scanner.Text(), "data: ")
+		if data == scanner.Text() {
+			// Blank lines separate the events
+			continue
+		}
+
+		var logLine DevLogLine
+		if err := json.Unmarshal([]byte(data), &logLine); err != nil {
+			return err
+		}
+
+		select {
+		case logChan <- logLine:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestDevAPIServer(t *testing.T, address string) (*DevAPIServer, *[]string, chan struct{}) {
+	var restarts []string
+	stopped := make(chan struct{})
+
+	s := NewDevAPIServer(address, func() []DevStageStatus {
+		return []DevStageStatus{
+			{Stage: "build", CommandStatus: CommandStatus{ExecLine: "go build", ExitStatus: "exit status 0"}},
+			{Stage: "start", CommandStatus: CommandStatus{ExecLine: "./app", IsService: true, Running: true}},
+		}
+	}, func(stage string) error {
+		switch stage {
+		case "", "build", "start":
+			restarts = append(restarts, stage)
+
+			return nil
+		case "unitTests":
+			return &StageError{Stage: 1, ExecLine: "go test", Err: errors.New("exit status 1")}
+		default:
+			return ErrUnknownStage
+		}
+	}, func() {
+		close(stopped)
+	})
+
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	return s, &restarts, stopped
+}
+
+func TestDevAPI(t *testing.T) {
+	s, restarts, stopped := newTestDevAPIServer(t, "127.0.0.1:0")
+	defer s.Stop()
+
+	c := NewDevAPIClient(s.Addr())
+
+	statuses, err := c.GetStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(statuses) != 2 || statuses[0].Stage != "build" || statuses[0].ExecLine != "go build" || !statuses[1].Running {
+		t.Error("status is wrong", statuses)
+	}
+
+	if _, err := c.Restart("build"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := c.Restart(""); err != nil {
+		t.Error(err)
+	}
+
+	if strings.Join(*restarts, ",") != "build," {
+		t.Error("stages have not been restarted", *restarts)
+	}
+
+	if _, err := c.Restart("unitTests"); err == nil || !strings.Contains(err.Error(), "go test") {
+		t.Error("failing stage did not return its error", err)
+	}
+
+	if _, err := c.Restart("deploy"); err == nil || err.Error() != ErrUnknownStage.Error() {
+		t.Error("unknown stage did not return an error", err)
+	}
+
+	if err := c.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second * 5):
+		t.Error("flow has not been stopped")
+	}
+}
+
+func TestDevAPILogs(t *testing.T) {
+	s, _, _ := newTestDevAPIServer(t, DevAPIUnixPrefix+filepath.Join(os.TempDir(), "dibs-dev-api-test.sock"))
+	defer s.Stop()
+
+	c := NewDevAPIClient(s.Addr())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logChan := make(chan DevLogLine)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- c.StreamLogs(ctx, logChan)
+	}()
+
+	// The client might not have subscribed yet, so lines are published until it has received one
+	go func() {
+		for ctx.Err() == nil {
+			s.Publish(StderrStream, "[api] listening")
+
+			time.Sleep(time.Millisecond * 10)
+		}
+	}()
+
+	select {
+	case logLine := <-logChan:
+		if logLine.Stream != StderrStream || logLine.Line != "[api] listening" || logLine.Time.IsZero() {
+			t.Error("log line is wrong", logLine)
+		}
+	case err := <-errChan:
+		t.Fatal("log stream ended", err)
+	case <-time.After(time.Second * 5):
+		t.Fatal("no log line has been streamed")
+	}
+
+	cancel()
+
+	if err := <-errChan; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDevAPICrossSiteRequests(t *testing.T) {
+	// Addresses without a host are not exposed to the network
+	s, restarts, _ := newTestDevAPIServer(t, ":0")
+	defer s.Stop()
+
+	if host, _, err := net.SplitHostPort(s.Addr()); err != nil || host != "127.0.0.1" {
+		t.Errorf("API is listening on %v, expected it to listen on localhost", s.Addr())
+	}
+
+	// Web pages can send simple requests without custom headers to the API
+	for _, path := range []string{"/restart", "/stop"} {
+		res, err := http.Post("http://"+s.Addr()+path, "text/plain", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusForbidden {
+			t.Errorf("POST %v without the %v header returned status %v, expected %v", path, DevAPIHeader, res.StatusCode, http.StatusForbidden)
+		}
+	}
+
+	if len(*restarts) != 0 {
+		t.Error("flow has been restarted by a request without the header", *restarts)
+	}
+
+	if _, err := NewDevAPIClient(s.Addr()).Restart("build"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+var (
+	// ErrNotInteractive is returned if the DevConsole's input is not a terminal
+	ErrNotInteractive = errors.New("input is not a terminal")
+)
+
+// ConsoleKey binds a key of a DevConsole to a handler
+type ConsoleKey struct {
+	Key         rune
+	Description string
+	Handler     func()
+}
+
+// DevConsole calls handlers for keys which are pressed in a terminal
+type DevConsole struct {
+	in       *os.File
+	out      io.Writer
+	keys     []ConsoleKey
+	restore  func() error
+	lock     sync.Mutex
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewDevConsole creates a new DevConsole which reads keys from in and writes its help to out
+func NewDevConsole(in *os.File, out io.Writer, keys []ConsoleKey) *DevConsole {
+	return &DevConsole{
+		in:   in,
+		out:  out,
+		keys: keys,
+		done: make(chan struct{}),
+	}
+}
+
+// IsInteractive returns true if the input of the DevConsole is a terminal
+func (c *DevConsole) IsInteractive() bool {
+	return term.IsTerminal(int(c.in.Fd()))
+}
+
+// Start switches the terminal to reading single keys without echoing them and calls the handlers of the pressed keys in a new goroutine.
+// Handlers are called one after another; keys which are pressed while a handler runs are handled afterwards.
+// If the input is not a terminal or its mode can't be changed, ErrNotInteractive or the error is returned.
+func (c *DevConsole) Start() error {
+	if !c.IsInteractive() {
+		return ErrNotInteractive
+	}
+
+	// Ctrl-C still sends SIGINT, as signals are not disabled
+	restore, err := enableCbreakMode(int(c.in.Fd()))
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	c.restore = restore
+	c.lock.Unlock()
+
+	go c.handleKeys(c.in)
+
+	return nil
+}
+
+func (c *DevConsole) handleKeys(in io.Reader) {
+	reader := bufio.NewReader(in)
+
+	for {
+		key, _, err := reader.ReadRune()
+		if err != nil {
+			return
+		}
+
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+
+		if handler := c.getHandler(key); handler != nil {
+			handler()
+		}
+	}
+}
+
+func (c *DevConsole) getHandler(key rune) func() {
+	for _, consoleKey := range c.keys {
+		if consoleKey.Key == key {
+			return consoleKey.Handler
+		}
+	}
+
+	return nil
+}
+
+// Help returns a description of the keys of the DevConsole, one per line
+func (c *DevConsole) Help() string {
+	var help strings.Builder
+	for _, consoleKey := range c.keys {
+		help.WriteString("  " + string(consoleKey.Key) + "  " + consoleKey.Description + "\n")
+	}
+
+	return help.String()
+}
+
+// PrintHelp writes the help of the DevConsole to its output
+func (c *DevConsole) PrintHelp() error {
+	_, err := io.WriteString(c.out, "Keys:\n"+c.Help())
+
+	return err
+}
+
+// Stop stops handling keys and restores the previous mode of the terminal
+func (c *DevConsole) Stop() error {
+	c.stopOnce.Do(func() {
+		close(c.done)
+	})
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.restore == nil {
+		return nil
+	}
+
+	restore := c.restore
+	c.restore = nil
+
+	return restore()
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+
+package utils
+
+import "errors"
+
+func enableCbreakMode(fd int) (func() error, error) {
+	return nil, errors.New("reading single keys is not supported on this platform")
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDevConsoleKeys(t *testing.T) {
+	var pressed []string
+
+	c := NewDevConsole(os.Stdin, &bytes.Buffer{}, []ConsoleKey{
+		{Key: 'r', Description: "Restart", Handler: func() { pressed = append(pressed, "restart") }},
+		{Key: 't', Description: "Test", Handler: func() { pressed = append(pressed, "test") }},
+	})
+
+	c.handleKeys(strings.NewReader("rxtr"))
+
+	if expected := "restart test restart"; strings.Join(pressed, " ") != expected {
+		t.Errorf("keys called %q, expected %q", pressed, expected)
+	}
+}
+
+func TestDevConsoleHelp(t *testing.T) {
+	out := &bytes.Buffer{}
+
+	c := NewDevConsole(os.Stdin, out, []ConsoleKey{
+		{Key: 'r', Description: "Restart"},
+		{Key: 'q', Description: "Quit"},
+	})
+
+	if err := c.PrintHelp(); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "Keys:\n  r  Restart\n  q  Quit\n"; out.String() != expected {
+		t.Errorf("help is %q, expected %q", out.String(), expected)
+	}
+}
+
+func TestDevConsoleNotInteractive(t *testing.T) {
+	in, out, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	defer out.Close()
+
+	c := NewDevConsole(in, &bytes.Buffer{}, nil)
+
+	if c.IsInteractive() {
+		t.Error("pipe is interactive")
+	}
+
+	if err := c.Start(); err != ErrNotInteractive {
+		t.Error("console started for a pipe", err)
+	}
+
+	if err := c.Stop(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,27 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package utils
+
+import "golang.org/x/sys/unix"
+
+// enableCbreakMode disables line buffering and echoing for the terminal fd and returns a function which restores its previous mode
+func enableCbreakMode(fd int) (func() error, error) {
+	termios, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := *termios
+
+	termios.Lflag &^= unix.ICANON | unix.ECHO
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+
+	if err := unix.IoctlSetTermios(fd, ioctlSetTermios, termios); err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		return unix.IoctlSetTermios(fd, ioctlSetTermios, &previous)
+	}, nil
+}
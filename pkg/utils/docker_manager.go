@@ -3,9 +3,23 @@ package utils
 import (
 	"errors"
 	"os"
+	"path"
 	"strings"
 )
 
+const (
+	// DevSyncMount mounts the context into the dev container
+	DevSyncMount = "mount"
+	// DevSyncCopy copies the context and the changed files into the dev container, e.g. for remote Docker hosts
+	DevSyncCopy = "copy"
+	// DefaultDevWorkdir is the directory in the dev container into which the context is mounted or copied if none is set
+	DefaultDevWorkdir = "/app"
+	// DevChangedFilesList is the path of the list of changed files in the dev container
+	DevChangedFilesList = "/tmp/dibs-changed-files"
+
+	devPIDDir = "/tmp"
+)
+
 // DockerManager manages Docker
 type DockerManager struct {
 	dir                    string
@@ -130,3 +144,153 @@ func (d *DockerManager) PushManifest(tag string) error {
 
 	return command.Wait()
 }
+
+func parseImagetoolsDigest(lines []string) string {
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "Digest:" {
+			return fields[1]
+		}
+	}
+
+	return ""
+}
+
+// GetManifestDigest returns the digest of a Docker manifest in a registry
+func (d *DockerManager) GetManifestDigest(tag string) (string, error) {
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+
+	command := NewManageableCommand("docker buildx imagetools inspect "+tag, d.dir, stdoutChan, stderrChan)
+
+	if err := command.Start(); err != nil {
+		return "", err
+	}
+
+	var lines []string
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case stdout := <-stdoutChan:
+				lines = append(lines, stdout)
+			case stderr := <-stderrChan:
+				d.stderrChan <- stderr
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := command.Wait()
+	done <- struct{}{}
+	if err != nil {
+		return "", err
+	}
+
+	digest := parseImagetoolsDigest(lines)
+	if digest == "" {
+		return "", errors.New("could not get digest of " + tag)
+	}
+
+	return digest, nil
+}
+
+// StartDevContainer starts a container of the dev image in the background, which keeps running until it is removed, and returns its ID.
+// If mount is set, the context is mounted to workdir; ports are published like with `docker run -p`.
+func (d *DockerManager) StartDevContainer(tag, context, workdir string, mount bool, ports []string) (string, error) {
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+
+	// The init process reaps the commands which are killed when they are restarted
+	execLine := getDockerRunPrefix() + " -d --init -w " + quoteShellArg(workdir)
+	if mount {
+		execLine += " -v " + quoteShellArg(context+":"+workdir)
+	}
+	for _, port := range ports {
+		execLine += " -p " + quoteShellArg(port)
+	}
+	execLine += " --entrypoint tail " + tag + " -f /dev/null"
+
+	command := NewManageableCommand(execLine, d.dir, stdoutChan, stderrChan)
+
+	if err := command.Start(); err != nil {
+		return "", err
+	}
+
+	var containerID string
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case id := <-stdoutChan:
+				containerID = id
+			case stderr := <-stderrChan:
+				d.stderrChan <- stderr
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := command.Wait()
+	done <- struct{}{}
+	if err != nil {
+		return "", err
+	}
+
+	if containerID == "" {
+		return "", errors.New("could not get ID of the dev container")
+	}
+
+	return containerID, nil
+}
+
+// getDevCommandScript returns a script which runs execLine in its own process group; the process group of the previous script with the same name is killed first
+func getDevCommandScript(name, execLine string) string {
+	pidFile := quoteShellArg(path.Join(devPIDDir, "dibs-"+name+".pid"))
+
+	return "if [ -f " + pidFile + " ]; then kill -9 -$(cat " + pidFile + ") 2>/dev/null; fi; " +
+		// setsid runs the command in a new process group with its pid, as the shell's children are not process group leaders
+		"setsid sh -c " + quoteShellArg(execLine) + " & echo $! > " + pidFile + "; wait $!"
+}
+
+// GetDevExecLine returns an exec line which runs execLine in the dev container in workdir.
+// The commands are restarted in the container, so a previous command with the same name which is still running is killed first;
+// the env variables of the dev flow are passed on.
+func GetDevExecLine(containerID, workdir, name, execLine string) string {
+	return "docker exec -w " + quoteShellArg(workdir) +
+		" -e DIBS_TARGET -e TARGETPLATFORM -e DIBS_DEBUG -e " + ChangedFilesEnv + " -e " + ChangedFilesListEnv + "=" + DevChangedFilesList +
+		" " + containerID + " sh -c " + quoteShellArg(getDevCommandScript(name, execLine))
+}
+
+// CopyToContainer copies the file or directory src on the host to dst in a container; to copy the contents of a directory, append `/.` to src
+func (d *DockerManager) CopyToContainer(containerID, src, dst string) error {
+	command := NewManageableCommand("docker cp "+quoteShellArg(src)+" "+quoteShellArg(containerID+":"+dst), d.dir, d.stdoutChan, d.stderrChan)
+
+	if err := command.Start(); err != nil {
+		return err
+	}
+
+	return command.Wait()
+}
+
+// RemoveFromContainer removes the file or directory at target from a container
+func (d *DockerManager) RemoveFromContainer(containerID, target string) error {
+	command := NewManageableCommand("docker exec "+containerID+" rm -rf "+quoteShellArg(target), d.dir, d.stdoutChan, d.stderrChan)
+
+	if err := command.Start(); err != nil {
+		return err
+	}
+
+	return command.Wait()
+}
+
+// RemoveContainer stops and removes a container, including all commands which are running in it
+func (d *DockerManager) RemoveContainer(containerID string) error {
+	command := NewManageableCommand("docker rm -f "+containerID, d.dir, d.stdoutChan, d.stderrChan)
+
+	if err := command.Start(); err != nil {
+		return err
+	}
+
+	return command.Wait()
+}
@@ -3,9 +3,11 @@ package utils
 import (
 	"log"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 var (
@@ -251,6 +253,22 @@ func TestBuildManifestDockerManager(t *testing.T) {
 	}
 }
 
+func TestParseImagetoolsDigest(t *testing.T) {
+	digest := parseImagetoolsDigest([]string{
+		"Name:      docker.io/pojntfx/test-app:latest",
+		"MediaType: application/vnd.docker.distribution.manifest.list.v2+json",
+		"Digest:    sha256:bfce9a091e8c12095a98008ef157129360d67b1d6f0fca9645aed04cff8b65c9",
+	})
+
+	if digest != "sha256:bfce9a091e8c12095a98008ef157129360d67b1d6f0fca9645aed04cff8b65c9" {
+		t.Error("digest not parsed correctly", digest)
+	}
+
+	if parseImagetoolsDigest([]string{"ERROR: not found"}) != "" {
+		t.Error("digest parsed from invalid output")
+	}
+}
+
 // TestPushManifestDockerManager requires the environment variable below to be set; it is disabled by default.
 func TestPushManifestDockerManager(t *testing.T) {
 	if os.Getenv("DIBS_DOCKER_MANIFEST_PUSH_TEST_ENABLED") == "1" {
@@ -295,3 +313,67 @@ func TestPushManifestDockerManager(t *testing.T) {
 		}
 	}
 }
+
+func TestDevCommandScript(t *testing.T) {
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+	go func() {
+		for {
+			select {
+			case stdout := <-stdoutChan:
+				t.Log("test stdout", stdout)
+			case stderr := <-stderrChan:
+				t.Log("test stderr", stderr)
+			}
+		}
+	}()
+
+	name := "dev-command-script-test"
+	defer os.Remove(filepath.Join(devPIDDir, "dibs-"+name+".pid"))
+
+	// The children of the command must be killed as well, as e.g. `go run` starts the app as a child
+	previous := NewManageableCommand(getDevCommandScript(name, "sleep 60 & wait"), testDir, stdoutChan, stderrChan)
+	if err := previous.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Give the previous command time to write its pid file
+	time.Sleep(500 * time.Millisecond)
+
+	exited := make(chan error)
+	go func() {
+		exited <- previous.Wait()
+	}()
+
+	next := NewManageableCommand(getDevCommandScript(name, "exit 3"), testDir, stdoutChan, stderrChan)
+	if err := next.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := next.Wait(); err == nil || next.GetExitCode() != 3 {
+		t.Error("exit code of the command has not been passed on", err)
+	}
+
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Error("previous command has not been killed")
+
+		_ = previous.Stop()
+	}
+
+	// The killed children might not have exited yet
+	for i := 0; ; i++ {
+		out, err := exec.Command("pgrep", "-f", "sleep 60 & wait").CombinedOutput()
+		if err != nil {
+			break
+		}
+
+		if i == 20 {
+			t.Error("children of the previous command are still running", string(out))
+
+			break
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+}
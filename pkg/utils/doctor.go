@@ -0,0 +1,303 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DoctorStatusOK is the status of a prerequisite which is met
+	DoctorStatusOK = "ok"
+	// DoctorStatusWarning is the status of a prerequisite which might cause stages to fail
+	DoctorStatusWarning = "warning"
+	// DoctorStatusError is the status of a prerequisite which is not met
+	DoctorStatusError = "error"
+
+	// DefaultDoctorTimeout is the time a check may take, e.g. if the Docker daemon does not respond
+	DefaultDoctorTimeout = 10 * time.Second
+)
+
+var versionRegexp = regexp.MustCompile(`\d+\.\d+(\.\d+)?`)
+
+// Tool is an executable which stages depend on
+type Tool struct {
+	// Name is the name of the executable in the PATH, e.g. `ghr`
+	Name string
+	// VersionArgs are passed to the executable to print its version; if it is empty, the version is not checked
+	VersionArgs []string
+	// MinVersion is the oldest supported version; if it is empty, all versions are supported
+	MinVersion string
+	// Install describes how to install the tool
+	Install string
+}
+
+// DoctorCheck is the result of checking a prerequisite
+type DoctorCheck struct {
+	Name    string   `json:"name"`
+	Status  string   `json:"status"`
+	Stages  []string `json:"stages"`
+	Version string   `json:"version,omitempty"`
+	Message string   `json:"message"`
+	// Hint describes how to fix the prerequisite if it is not met
+	Hint string `json:"hint,omitempty"`
+}
+
+// DoctorReport is the result of checking all prerequisites
+type DoctorReport struct {
+	Checks []DoctorCheck `json:"checks"`
+	// OK is false if any check has failed
+	OK bool `json:"ok"`
+}
+
+// NewDoctorReport creates a new DoctorReport
+func NewDoctorReport(checks []DoctorCheck) *DoctorReport {
+	report := &DoctorReport{Checks: checks, OK: true}
+	for _, check := range checks {
+		if check.Status == DoctorStatusError {
+			report.OK = false
+		}
+	}
+
+	return report
+}
+
+// DoctorManager checks whether the tools which stages depend on are installed and usable
+type DoctorManager struct {
+	dir     string
+	timeout time.Duration
+}
+
+// NewDoctorManager creates a new DoctorManager
+func NewDoctorManager(dir string) *DoctorManager {
+	return &DoctorManager{
+		dir:     dir,
+		timeout: DefaultDoctorTimeout,
+	}
+}
+
+// ParseVersion returns the first version number in the output of a tool, e.g. `0.11.2` for `github.com/docker/buildx v0.11.2 9872040`
+func ParseVersion(output string) string {
+	return versionRegexp.FindString(output)
+}
+
+// CompareVersions returns -1 if version a is older than b, 1 if it is newer and 0 if they are the same
+func CompareVersions(a, b string) int {
+	partsA, partsB := strings.Split(a, "."), strings.Split(b, ".")
+
+	for i := 0; i < len(partsA) || i < len(partsB); i++ {
+		var numberA, numberB int
+		if i < len(partsA) {
+			numberA, _ = strconv.Atoi(partsA[i])
+		}
+		if i < len(partsB) {
+			numberB, _ = strconv.Atoi(partsB[i])
+		}
+
+		if numberA < numberB {
+			return -1
+		}
+		if numberA > numberB {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func (d *DoctorManager) run(name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+
+	command := exec.CommandContext(ctx, name, args...)
+	command.Dir = d.dir
+
+	output, err := command.CombinedOutput()
+	if ctx.Err() != nil {
+		return string(output), errors.New(name + " did not respond within " + d.timeout.String())
+	}
+	if err != nil {
+		return string(output), errors.New(strings.TrimSpace(string(output) + " " + err.Error()))
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// CheckTool checks whether tool is in the PATH and at least at its MinVersion
+func (d *DoctorManager) CheckTool(tool Tool, stages []string) DoctorCheck {
+	check := DoctorCheck{Name: tool.Name, Stages: stages, Hint: tool.Install}
+
+	path, err := exec.LookPath(tool.Name)
+	if err != nil {
+		check.Status, check.Message = DoctorStatusError, tool.Name+" is not installed or not in the PATH"
+
+		return check
+	}
+
+	if len(tool.VersionArgs) == 0 {
+		check.Status, check.Message, check.Hint = DoctorStatusOK, "found at "+path, ""
+
+		return check
+	}
+
+	output, err := d.run(path, tool.VersionArgs...)
+	if err != nil {
+		check.Status, check.Message = DoctorStatusError, "could not get the version of "+tool.Name+": "+err.Error()
+
+		return check
+	}
+
+	check.Version = ParseVersion(output)
+	if check.Version == "" {
+		check.Status, check.Message, check.Hint = DoctorStatusWarning, "found at "+path+", but could not parse its version from "+strconv.Quote(output), ""
+
+		return check
+	}
+
+	if tool.MinVersion != "" && CompareVersions(check.Version, tool.MinVersion) < 0 {
+		check.Status, check.Message = DoctorStatusError, tool.Name+" "+check.Version+" is too old, at least "+tool.MinVersion+" is required"
+
+		return check
+	}
+
+	check.Status, check.Message, check.Hint = DoctorStatusOK, "found "+tool.Name+" "+check.Version+" at "+path, ""
+
+	return check
+}
+
+// CheckDockerDaemon checks whether the Docker daemon is running and its socket is accessible
+func (d *DoctorManager) CheckDockerDaemon(stages []string) DoctorCheck {
+	check := DoctorCheck{Name: "docker daemon", Stages: stages}
+
+	output, err := d.run("docker", "version", "--format", "{{.Server.Version}}")
+	if err != nil {
+		check.Status, check.Message = DoctorStatusError, "could not access the Docker daemon: "+err.Error()
+
+		switch {
+		case strings.Contains(err.Error(), "permission denied"):
+			check.Hint = "add your user to the docker group with `sudo usermod -aG docker $USER` and log in again, or set DOCKER_HOST"
+		default:
+			check.Hint = "start the Docker daemon or set DOCKER_HOST to a running one"
+		}
+
+		return check
+	}
+
+	check.Status, check.Version, check.Message = DoctorStatusOK, ParseVersion(output), "the Docker daemon is accessible"
+
+	return check
+}
+
+// CheckBuildxBuilder checks whether the current buildx builder is usable and supports platforms
+func (d *DoctorManager) CheckBuildxBuilder(platforms, stages []string) DoctorCheck {
+	check := DoctorCheck{Name: "buildx builder", Stages: stages}
+
+	output, err := d.run("docker", "buildx", "inspect")
+	if err != nil {
+		check.Status, check.Message, check.Hint = DoctorStatusError, "could not inspect the current buildx builder: "+err.Error(), "create one with `docker buildx create --use`"
+
+		return check
+	}
+
+	var (
+		name, driver, status string
+		builderPlatforms     = map[string]bool{}
+	)
+	for _, line := range strings.Split(output, "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		switch {
+		case key == "Name" && name == "":
+			name = value
+		case key == "Driver" && driver == "":
+			driver = value
+		case key == "Status" && status == "":
+			status = value
+		case key == "Platforms":
+			for _, platform := range strings.Split(value, ",") {
+				builderPlatforms[strings.TrimSuffix(strings.TrimSpace(platform), "*")] = true
+			}
+		}
+	}
+
+	if name == "" {
+		check.Status, check.Message, check.Hint = DoctorStatusError, "could not parse the current buildx builder from "+strconv.Quote(output), "create one with `docker buildx create --use`"
+
+		return check
+	}
+
+	check.Message = "builder " + name + " (" + driver + ") is " + status
+
+	if status != "running" && status != "inactive" {
+		check.Status, check.Hint = DoctorStatusError, "start it with `docker buildx inspect --bootstrap` or create a new one with `docker buildx create --use`"
+
+		return check
+	}
+
+	// Builders which have not been started yet don't list their platforms
+	var missing []string
+	if len(builderPlatforms) > 0 {
+		for _, platform := range platforms {
+			if !builderPlatforms[platform] {
+				missing = append(missing, platform)
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		check.Status, check.Message = DoctorStatusWarning, check.Message+", but does not list "+strings.Join(missing, ", ")
+		check.Hint = "register the binfmt_misc handlers with `docker run --privileged --rm tonistiigi/binfmt --install all` and recreate the builder"
+
+		return check
+	}
+
+	check.Status = DoctorStatusOK
+
+	return check
+}
+
+// CheckEmulation checks whether the non-native platforms can be emulated by the binfmt_misc handlers in binfmtDir
+func (d *DoctorManager) CheckEmulation(binfmtDir string, platforms, stages []string) DoctorCheck {
+	check := DoctorCheck{Name: "binfmt_misc", Stages: stages}
+
+	err := CheckEmulation(binfmtDir, platforms)
+	switch {
+	case errors.Is(err, ErrBinfmtUnavailable):
+		check.Status, check.Message = DoctorStatusWarning, err.Error()
+	case err != nil:
+		// The error already describes how to register the handlers
+		check.Status, check.Message = DoctorStatusError, err.Error()
+	default:
+		check.Status, check.Message = DoctorStatusOK, "all platforms can be run"
+	}
+
+	return check
+}
+
+// GetQEMUUserTool returns the qemu-user binary which emulates platform; it prefers the installed binary and the static one if none is installed
+func GetQEMUUserTool(platform string) (Tool, error) {
+	qemuArch, err := GetQEMUArch(platform)
+	if err != nil {
+		return Tool{}, err
+	}
+
+	name := "qemu-" + qemuArch + "-static"
+	if path, err := GetQEMUUserBinary(platform); err == nil {
+		name = filepath.Base(path)
+	}
+
+	return Tool{
+		Name:        name,
+		VersionArgs: []string{"--version"},
+		Install:     "install qemu-user-static, e.g. with your package manager",
+	}, nil
+}
@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setupFakeTools writes executables which print their outputs into a temporary directory and sets it as the PATH
+func setupFakeTools(t *testing.T, outputs map[string]string) {
+	dir, err := ioutil.TempDir("", "dibs-doctor-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	for name, output := range outputs {
+		script := "#!/bin/sh\ncat <<'EOF'\n" + output + "\nEOF\n"
+
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+"/bin"+string(os.PathListSeparator)+"/usr/bin")
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, versions := range [][]string{
+		{"0.3.0", "0.11.2", "-1"},
+		{"19.03.12", "19.03.0", "1"},
+		{"20.10", "20.10.0", "0"},
+	} {
+		expected := map[string]int{"-1": -1, "0": 0, "1": 1}[versions[2]]
+
+		if actual := CompareVersions(versions[0], versions[1]); actual != expected {
+			t.Errorf("comparing %v with %v returned %v, expected %v", versions[0], versions[1], actual, expected)
+		}
+	}
+
+	if version := ParseVersion("github.com/docker/buildx v0.11.2 9872040"); version != "0.11.2" {
+		t.Errorf("parsed version is %v, expected 0.11.2", version)
+	}
+}
+
+func TestDoctorCheckTool(t *testing.T) {
+	setupFakeTools(t, map[string]string{
+		"ghr": "ghr version v0.16.0 (abcdef)",
+		"old": "old version 0.1.0",
+	})
+
+	d := NewDoctorManager("")
+
+	for _, testCase := range []struct {
+		tool    Tool
+		status  string
+		version string
+	}{
+		{Tool{Name: "ghr", VersionArgs: []string{"-version"}, MinVersion: "0.13.0"}, DoctorStatusOK, "0.16.0"},
+		{Tool{Name: "old", VersionArgs: []string{"-version"}, MinVersion: "0.13.0"}, DoctorStatusError, "0.1.0"},
+		{Tool{Name: "missing", VersionArgs: []string{"-version"}}, DoctorStatusError, ""},
+	} {
+		check := d.CheckTool(testCase.tool, []string{"pushBinary"})
+
+		if check.Status != testCase.status || check.Version != testCase.version {
+			t.Errorf("check of %v is %v with version %q, expected %v with version %q: %v", testCase.tool.Name, check.Status, check.Version, testCase.status, testCase.version, check.Message)
+		}
+	}
+}
+
+func TestDoctorCheckBuildxBuilder(t *testing.T) {
+	setupFakeTools(t, map[string]string{
+		"docker": `Name:          dibs
+Driver:        docker-container
+Last Activity: 2023-10-01 12:00:00 +0000 UTC
+
+Nodes:
+Name:      dibs0
+Endpoint:  unix:///var/run/docker.sock
+Status:    running
+Platforms: linux/amd64*, linux/386, linux/arm64`,
+	})
+
+	d := NewDoctorManager("")
+
+	if check := d.CheckBuildxBuilder([]string{"linux/amd64", "linux/arm64"}, []string{"buildImage"}); check.Status != DoctorStatusOK {
+		t.Errorf("check is %v, expected %v: %v", check.Status, DoctorStatusOK, check.Message)
+	}
+
+	check := d.CheckBuildxBuilder([]string{"linux/amd64", "linux/riscv64"}, []string{"buildImage"})
+	if check.Status != DoctorStatusWarning || !strings.Contains(check.Message, "linux/riscv64") {
+		t.Errorf("check is %v, expected a %v about linux/riscv64: %v", check.Status, DoctorStatusWarning, check.Message)
+	}
+
+	if report := NewDoctorReport([]DoctorCheck{check}); !report.OK {
+		t.Error("report with warnings is not OK")
+	}
+}
@@ -0,0 +1,318 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// BinfmtMiscDir is the directory in which the kernel lists the registered binfmt_misc handlers
+const BinfmtMiscDir = "/proc/sys/fs/binfmt_misc"
+
+// ErrBinfmtUnavailable is returned if the binfmt_misc handlers can't be listed, e.g. because binfmt_misc is not mounted in a container
+var ErrBinfmtUnavailable = errors.New("could not list the binfmt_misc handlers")
+
+// qemuArchs maps the architectures of platform identifiers to the architectures of QEMU
+var qemuArchs = map[string]string{
+	"amd64":    "x86_64",
+	"386":      "i386",
+	"arm64":    "aarch64",
+	"arm":      "arm",
+	"ppc64le":  "ppc64le",
+	"s390x":    "s390x",
+	"riscv64":  "riscv64",
+	"mips64le": "mips64el",
+	"mips64":   "mips64",
+	"mipsle":   "mipsel",
+	"mips":     "mips",
+}
+
+// elfMachine identifies the binaries of an architecture in their ELF headers
+type elfMachine struct {
+	is64Bit, isBigEndian bool
+	machine              uint16
+}
+
+// elfMachines maps the architectures of platform identifiers to the ELF machines of their binaries
+var elfMachines = map[string]elfMachine{
+	"amd64":    {true, false, 62},
+	"386":      {false, false, 3},
+	"arm64":    {true, false, 183},
+	"arm":      {false, false, 40},
+	"ppc64le":  {true, false, 21},
+	"s390x":    {true, true, 22},
+	"riscv64":  {true, false, 243},
+	"mips64le": {true, false, 8},
+	"mips64":   {true, true, 8},
+	"mipsle":   {false, false, 8},
+	"mips":     {false, true, 8},
+}
+
+// EmulationError is returned if platforms can't be run because no binfmt_misc handlers are registered for them
+type EmulationError struct {
+	Platforms []string
+}
+
+func (e *EmulationError) Error() string {
+	var platforms []string
+	for _, platform := range e.Platforms {
+		// The platforms have been checked before
+		arch, _ := GetQEMUArch(platform)
+
+		platforms = append(platforms, platform+" (qemu-"+arch+")")
+	}
+
+	return "no binfmt_misc handlers are registered for " + strings.Join(platforms, ", ") +
+		"; register them with `docker run --privileged --rm tonistiigi/binfmt --install all` or `docker run --rm --privileged multiarch/qemu-user-static --reset -p yes`"
+}
+
+func splitPlatform(platform string) (string, string) {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 {
+		return parts[0], ""
+	}
+
+	return parts[0], parts[1]
+}
+
+// GetQEMUArch returns the architecture which QEMU uses for the architecture of platform, e.g. `aarch64` for `linux/arm64`
+func GetQEMUArch(platform string) (string, error) {
+	_, arch := splitPlatform(platform)
+
+	qemuArch, ok := qemuArchs[arch]
+	if !ok {
+		return "", errors.New("can't emulate unknown architecture of platform " + platform)
+	}
+
+	return qemuArch, nil
+}
+
+// IsNativePlatform returns whether platform can be run without emulation
+func IsNativePlatform(platform string) bool {
+	os, arch := splitPlatform(platform)
+	if os != runtime.GOOS {
+		return false
+	}
+
+	// amd64 CPUs can run 386 binaries
+	return arch == runtime.GOARCH || (runtime.GOARCH == "amd64" && arch == "386")
+}
+
+func isQEMUInterpreter(path, qemuArch string) bool {
+	name := filepath.Base(path)
+
+	return name == "qemu-"+qemuArch || name == "qemu-"+qemuArch+"-static"
+}
+
+// getELFHeader returns the start of the ELF header of an executable of the architecture of platform, up to and including e_machine
+func getELFHeader(platform string) ([]byte, bool) {
+	_, arch := splitPlatform(platform)
+
+	machine, ok := elfMachines[arch]
+	if !ok {
+		return nil, false
+	}
+
+	header := make([]byte, 20)
+	copy(header, "\x7fELF")
+
+	header[4], header[5], header[6] = 1, 1, 1
+	if machine.is64Bit {
+		header[4] = 2
+	}
+
+	// e_type is ET_EXEC
+	if machine.isBigEndian {
+		header[5] = 2
+		header[17], header[18], header[19] = 2, byte(machine.machine>>8), byte(machine.machine)
+	} else {
+		header[16], header[18], header[19] = 2, byte(machine.machine), byte(machine.machine>>8)
+	}
+
+	return header, true
+}
+
+// matchesMagic returns whether a binfmt_misc handler with the hex-encoded magic and mask at offset 0 matches header
+func matchesMagic(header []byte, offset, magic, mask string) bool {
+	if offset != "" && offset != "0" {
+		return false
+	}
+
+	rawMagic, err := hex.DecodeString(magic)
+	if err != nil || len(rawMagic) == 0 || len(rawMagic) > len(header) {
+		return false
+	}
+
+	rawMask := bytes.Repeat([]byte{0xff}, len(rawMagic))
+	if mask != "" {
+		if rawMask, err = hex.DecodeString(mask); err != nil || len(rawMask) != len(rawMagic) {
+			return false
+		}
+	}
+
+	for i := range rawMagic {
+		if header[i]&rawMask[i] != rawMagic[i]&rawMask[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// IsBinfmtRegistered returns whether an enabled binfmt_misc handler in binfmtDir runs the architecture of platform.
+// Handlers match if their magic matches the ELF header of the architecture, so that the names of their interpreters don't matter,
+// e.g. `/usr/libexec/qemu-binfmt/aarch64-binfmt-P` of Debian's qemu-user-binfmt; handlers without a magic match if their interpreter is named after QEMU.
+func IsBinfmtRegistered(binfmtDir, platform string) (bool, error) {
+	qemuArch, err := GetQEMUArch(platform)
+	if err != nil {
+		return false, err
+	}
+
+	// binfmt_misc always has a register file if it is mounted
+	if _, err := os.Stat(filepath.Join(binfmtDir, "register")); err != nil {
+		return false, fmt.Errorf("%w, is binfmt_misc mounted at %v? %v", ErrBinfmtUnavailable, binfmtDir, err)
+	}
+
+	handlers, err := ioutil.ReadDir(binfmtDir)
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrBinfmtUnavailable, err)
+	}
+
+	for _, handler := range handlers {
+		if handler.IsDir() || handler.Name() == "register" || handler.Name() == "status" {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(filepath.Join(binfmtDir, handler.Name()))
+		if err != nil {
+			return false, err
+		}
+
+		enabled, interpreter, offset, magic, mask := false, "", "", "", ""
+		for _, line := range strings.Split(string(content), "\n") {
+			fields := strings.Fields(line)
+
+			switch {
+			case len(fields) == 1 && fields[0] == "enabled":
+				enabled = true
+			case len(fields) == 2 && fields[0] == "interpreter":
+				interpreter = fields[1]
+			case len(fields) == 2 && fields[0] == "offset":
+				offset = fields[1]
+			case len(fields) == 2 && fields[0] == "magic":
+				magic = fields[1]
+			case len(fields) == 2 && fields[0] == "mask":
+				mask = fields[1]
+			}
+		}
+
+		if !enabled {
+			continue
+		}
+
+		if magic == "" {
+			if isQEMUInterpreter(interpreter, qemuArch) {
+				return true, nil
+			}
+
+			continue
+		}
+
+		if header, ok := getELFHeader(platform); ok && matchesMagic(header, offset, magic, mask) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// CheckEmulation returns an EmulationError which lists the platforms that are not native and have no binfmt_misc handler in binfmtDir.
+// binfmt_misc only exists on Linux; on other systems, Docker brings its own emulation, so nil is returned.
+func CheckEmulation(binfmtDir string, platforms []string) error {
+	if runtime.GOOS != "linux" {
+		return nil
+	}
+
+	var missing []string
+	for _, platform := range platforms {
+		if IsNativePlatform(platform) {
+			continue
+		}
+
+		registered, err := IsBinfmtRegistered(binfmtDir, platform)
+		if err != nil {
+			return err
+		}
+
+		if !registered {
+			missing = append(missing, platform)
+		}
+	}
+
+	if len(missing) > 0 {
+		return &EmulationError{Platforms: missing}
+	}
+
+	return nil
+}
+
+// GetQEMUUserBinary returns the path of the installed qemu-user binary for the architecture of platform
+func GetQEMUUserBinary(platform string) (string, error) {
+	qemuArch, err := GetQEMUArch(platform)
+	if err != nil {
+		return "", err
+	}
+
+	for _, name := range []string{"qemu-" + qemuArch + "-static", "qemu-" + qemuArch} {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+
+	return "", errors.New("qemu-" + qemuArch + " is not installed")
+}
+
+// GetEmulatedExecLine returns an exec line which runs the binary that execLine runs through qemuBinary.
+// Only exec lines whose first word is a path, e.g. `.bin/binaries/test-app-linux-arm64 -help`, are emulated; it is relative to dir
+// and might not exist yet, e.g. because it is built later. All other exec lines, e.g. `go test ./...`, and scripts are returned as they are.
+func GetEmulatedExecLine(qemuBinary, dir, execLine string) string {
+	fields := strings.Fields(execLine)
+	if len(fields) == 0 || !strings.Contains(fields[0], "/") {
+		return execLine
+	}
+
+	file := fields[0]
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(dir, file)
+	}
+
+	if isELF, err := isELFFile(file); err == nil && !isELF {
+		return execLine
+	}
+
+	return quoteShellArg(qemuBinary) + " " + strings.TrimLeft(execLine, " \t")
+}
+
+func isELFFile(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(file, magic); err != nil {
+		// Files which are shorter than the magic number are no binaries
+		return false, nil
+	}
+
+	return string(magic) == "\x7fELF", nil
+}
@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func getForeignPlatforms() (string, string) {
+	if runtime.GOARCH == "arm64" {
+		return runtime.GOOS + "/amd64", runtime.GOOS + "/riscv64"
+	}
+
+	return runtime.GOOS + "/arm64", runtime.GOOS + "/riscv64"
+}
+
+func TestGetQEMUArch(t *testing.T) {
+	for platform, expected := range map[string]string{
+		"linux/amd64":  "x86_64",
+		"linux/arm64":  "aarch64",
+		"linux/arm/v7": "arm",
+	} {
+		qemuArch, err := GetQEMUArch(platform)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if qemuArch != expected {
+			t.Errorf("QEMU arch of %v is %v, expected %v", platform, qemuArch, expected)
+		}
+	}
+
+	if _, err := GetQEMUArch("linux/sparc"); err == nil {
+		t.Error("unknown architecture did not return an error")
+	}
+
+	if !IsNativePlatform(runtime.GOOS + "/" + runtime.GOARCH) {
+		t.Error("native platform is not native")
+	}
+
+	foreignPlatform, _ := getForeignPlatforms()
+	if IsNativePlatform(foreignPlatform) {
+		t.Errorf("foreign platform %v is native", foreignPlatform)
+	}
+}
+
+func TestCheckEmulation(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("binfmt_misc only exists on Linux")
+	}
+
+	registeredPlatform, missingPlatform := getForeignPlatforms()
+	registeredArch, _ := GetQEMUArch(registeredPlatform)
+	missingArch, _ := GetQEMUArch(missingPlatform)
+
+	binfmtDir, err := ioutil.TempDir("", "dibs-binfmt-misc-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(binfmtDir)
+
+	for name, content := range map[string]string{
+		"register":                  "",
+		"status":                    "enabled\n",
+		"qemu-" + registeredArch:    "enabled\ninterpreter /usr/bin/qemu-" + registeredArch + "-static\nflags: F\n",
+		"qemu-" + missingArch:       "disabled\ninterpreter /usr/bin/qemu-" + missingArch + "\nflags: F\n",
+		"qemu-" + missingArch + "2": "enabled\ninterpreter /usr/bin/box64\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(binfmtDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := CheckEmulation(binfmtDir, []string{runtime.GOOS + "/" + runtime.GOARCH, registeredPlatform}); err != nil {
+		t.Error(err)
+	}
+
+	err = CheckEmulation(binfmtDir, []string{registeredPlatform, missingPlatform})
+	emulationErr, ok := err.(*EmulationError)
+	if !ok {
+		t.Fatalf("error is %v, expected an emulation error", err)
+	}
+
+	if len(emulationErr.Platforms) != 1 || emulationErr.Platforms[0] != missingPlatform {
+		t.Errorf("missing platforms are %v, expected %v", emulationErr.Platforms, missingPlatform)
+	}
+
+	if err := CheckEmulation(filepath.Join(binfmtDir, "missing"), []string{missingPlatform}); !errors.Is(err, ErrBinfmtUnavailable) {
+		t.Errorf("error of a missing binfmt_misc dir is %v, expected %v", err, ErrBinfmtUnavailable)
+	}
+}
+
+func TestIsBinfmtRegisteredMagic(t *testing.T) {
+	binfmtDir, err := ioutil.TempDir("", "dibs-binfmt-misc-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(binfmtDir)
+
+	// The handlers are matched by their magic, not by the names of their interpreters
+	for name, content := range map[string]string{
+		"register":     "",
+		"qemu-aarch64": "enabled\ninterpreter /usr/libexec/qemu-binfmt/aarch64-binfmt-P\nflags: POCF\noffset 0\nmagic 7f454c460201010000000000000000000200b700\nmask ffffffffffffff00fffffffffffffffffeffffff\n",
+		"box64":        "enabled\ninterpreter /usr/local/bin/box64\nflags: \noffset 0\nmagic 7f454c4602010100000000000000000002003e00\nmask fffffffffffffffcfffffffffffffffffeffffff\n",
+		"qemu-riscv64": "disabled\ninterpreter /usr/libexec/qemu-binfmt/riscv64-binfmt-P\nflags: POCF\noffset 0\nmagic 7f454c460201010000000000000000000200f300\nmask ffffffffffffff00fffffffffffffffffeffffff\n",
+		"qemu-s390x":   "enabled\ninterpreter /usr/bin/qemu-s390x-static\nflags: F\noffset 0\nmagic 7f454c4602020100000000000000000000020016\nmask ffffffffffffff00fffffffffffffffffffeffff\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(binfmtDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for platform, expected := range map[string]bool{
+		"linux/arm64": true,
+		// Handlers which are not QEMU run binaries too
+		"linux/amd64":   true,
+		"linux/riscv64": false,
+		"linux/s390x":   true,
+		"linux/arm/v7":  false,
+	} {
+		registered, err := IsBinfmtRegistered(binfmtDir, platform)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if registered != expected {
+			t.Errorf("%v is registered: %v, expected %v", platform, registered, expected)
+		}
+	}
+}
+
+func TestGetEmulatedExecLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dibs-emulation-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "app"), []byte("\x7fELF binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "start.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for execLine, expected := range map[string]string{
+		"./app -verbose":     "'/usr/bin/qemu-aarch64' ./app -verbose",
+		".bin/not-yet-built": "'/usr/bin/qemu-aarch64' .bin/not-yet-built",
+		"./start.sh":         "./start.sh",
+		"go test ./...":      "go test ./...",
+		"":                   "",
+	} {
+		if actual := GetEmulatedExecLine("/usr/bin/qemu-aarch64", dir, execLine); actual != expected {
+			t.Errorf("emulated exec line of %q is %q, expected %q", execLine, actual, expected)
+		}
+	}
+}
@@ -1,12 +1,47 @@
 package utils
 
 import (
-	"gopkg.in/src-d/go-git.v4"
-	"gopkg.in/src-d/go-git.v4/plumbing/object"
-	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	"errors"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/downloader"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/lint/support"
+	"helm.sh/helm/v3/pkg/provenance"
+	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"helm.sh/helm/v3/pkg/repo"
+	"helm.sh/helm/v3/pkg/strvals"
+	"k8s.io/apimachinery/pkg/runtime"
+	kjson "k8s.io/apimachinery/pkg/runtime/serializer/json"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// DefaultChartAuthorName is the name of the author of the commits to chart repositories if none is set
+	DefaultChartAuthorName = "dibs"
+	// DefaultChartAuthorEmail is the email of the author of the commits to chart repositories if none is set
+	DefaultChartAuthorEmail = "dibs@localhost"
 )
 
 // HelmManager manages Helm
@@ -24,67 +59,386 @@ func NewHelmManager(dir string, stdoutChan, stderrChan chan string) *HelmManager
 	}
 }
 
-// Build builds a Helm chart
-func (h *HelmManager) Build(src, dist string) error {
-	depUpCommand := NewManageableCommand("helm dep up "+src, h.dir, h.stdoutChan, h.stderrChan)
+// InvalidChartError is returned if a Helm chart can't be loaded or linted
+type InvalidChartError struct {
+	Chart  string
+	Errors []error
+}
+
+func (e *InvalidChartError) Error() string {
+	var messages []string
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+
+	return "invalid Helm chart " + e.Chart + ": " + strings.Join(messages, "; ")
+}
+
+// chanWriter writes lines to a channel
+type chanWriter struct {
+	outChan chan string
+}
+
+func (w *chanWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		w.outChan <- line
+	}
+
+	return len(p), nil
+}
+
+// Build resolves the dependencies of, lints and packages a Helm chart.
+// If version is set, it is used as the chart's version and appVersion; setValues (such as `image=pojntfx/test-app:latest`) are written into the packaged chart's values.yaml.
+func (h *HelmManager) Build(src, dist, version string, setValues []string) error {
+	settings := cli.New()
+	out := &chanWriter{h.stdoutChan}
+
+	if _, err := loader.Load(src); err != nil {
+		return &InvalidChartError{Chart: src, Errors: []error{err}}
+	}
 
-	if err := depUpCommand.Start(); err != nil {
+	dependencyManager := &downloader.Manager{
+		Out:              out,
+		ChartPath:        src,
+		Getters:          getter.All(settings),
+		RepositoryConfig: settings.RepositoryConfig,
+		RepositoryCache:  settings.RepositoryCache,
+	}
+	if err := dependencyManager.Update(); err != nil {
 		return err
 	}
 
-	if err := depUpCommand.Wait(); err != nil {
+	lint := action.NewLint()
+	lintResult := lint.Run([]string{src}, map[string]interface{}{})
+	for _, message := range lintResult.Messages {
+		if message.Severity < support.ErrorSev {
+			out.Write([]byte(message.Error()))
+		}
+	}
+	if len(lintResult.Errors) > 0 {
+		return &InvalidChartError{Chart: src, Errors: lintResult.Errors}
+	}
+
+	loadedChart, err := loader.LoadDir(src)
+	if err != nil {
+		return &InvalidChartError{Chart: src, Errors: []error{err}}
+	}
+
+	if version != "" {
+		loadedChart.Metadata.Version = strings.TrimPrefix(version, "v")
+		loadedChart.Metadata.AppVersion = version
+	}
+
+	if err := loadedChart.Validate(); err != nil {
+		return &InvalidChartError{Chart: src, Errors: []error{err}}
+	}
+
+	if err := setChartValues(loadedChart, setValues); err != nil {
 		return err
 	}
 
-	buildCommand := NewManageableCommand("helm package -d "+dist+" "+src, h.dir, h.stdoutChan, h.stderrChan)
+	if dependencies := loadedChart.Metadata.Dependencies; dependencies != nil {
+		if err := action.CheckDependencies(loadedChart, dependencies); err != nil {
+			return err
+		}
+	}
 
-	if err := buildCommand.Start(); err != nil {
+	if err := os.MkdirAll(dist, 0777); err != nil {
 		return err
 	}
 
-	return buildCommand.Wait()
+	chartPath, err := chartutil.Save(loadedChart, dist)
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Write([]byte("Successfully packaged chart and saved it to: " + chartPath))
+
+	return err
 }
 
-// Push releases a Helm chart using GitHub, GitHub releases and GitHub pages
-func (h *HelmManager) Push(gitUserName, gitUserEmail, gitCommitMessage, githubUserName, githubToken, githubRepositoryName, githubRepositoryUrl, githubPagesUrl, chartDist, cloneDir string) error {
-	uploadCommand := NewManageableCommand("cr upload -o "+githubUserName+" -t "+githubToken+" -r "+githubRepositoryName+" -p "+chartDist, h.dir, h.stdoutChan, h.stderrChan)
+// setChartValues sets values such as `image=pojntfx/test-app:latest` in the chart's values.yaml
+func setChartValues(loadedChart *chart.Chart, setValues []string) error {
+	if len(setValues) == 0 {
+		return nil
+	}
 
-	if err := uploadCommand.Start(); err != nil {
-		return err
+	for _, file := range loadedChart.Raw {
+		if file.Name != chartutil.ValuesfileName {
+			continue
+		}
+
+		values, err := chartutil.ReadValues(file.Data)
+		if err != nil {
+			return err
+		}
+
+		for _, setValue := range setValues {
+			if err := strvals.ParseInto(setValue, values); err != nil {
+				return err
+			}
+		}
+
+		data, err := yaml.Marshal(values.AsMap())
+		if err != nil {
+			return err
+		}
+
+		file.Data = data
+		loadedChart.Values = values.AsMap()
+
+		return nil
 	}
 
-	if err := uploadCommand.Wait(); err != nil {
-		return err
+	return errors.New("chart " + loadedChart.Name() + " has no " + chartutil.ValuesfileName)
+}
+
+// UpdateIndex merges the charts into the Helm repository index at indexPath, replacing existing entries with the same version
+func (h *HelmManager) UpdateIndex(indexPath string, chartURLs map[string]string) error {
+	index := repo.NewIndexFile()
+	if _, err := os.Stat(indexPath); err == nil {
+		index, err = repo.LoadIndexFile(indexPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	charts := make([]string, 0, len(chartURLs))
+	for chart := range chartURLs {
+		charts = append(charts, chart)
+	}
+	sort.Strings(charts)
+
+	for _, chart := range charts {
+		loadedChart, err := loader.Load(chart)
+		if err != nil {
+			return &InvalidChartError{Chart: chart, Errors: []error{err}}
+		}
+
+		digest, err := provenance.DigestFile(chart)
+		if err != nil {
+			return err
+		}
+
+		metadata := loadedChart.Metadata
+
+		var versions repo.ChartVersions
+		for _, version := range index.Entries[metadata.Name] {
+			if version.Version != metadata.Version {
+				versions = append(versions, version)
+			}
+		}
+		index.Entries[metadata.Name] = versions
+
+		if err := index.MustAdd(metadata, filepath.Base(chart), "", digest); err != nil {
+			return err
+		}
+
+		added, err := index.Get(metadata.Name, metadata.Version)
+		if err != nil {
+			return err
+		}
+		added.URLs = []string{chartURLs[chart]}
+	}
+
+	index.SortEntries()
+	index.Generated = time.Now()
+
+	return index.WriteFile(indexPath, 0644)
+}
+
+// GitChartRepository is a Git repository which serves a Helm chart repository, e.g. using GitHub pages
+type GitChartRepository struct {
+	// URL is the URL of the Git repository, e.g. `https://github.com/pojntfx/charts.git`, `git@github.com:pojntfx/charts.git` or `/srv/charts.git`
+	URL string
+	// Branch is the branch to push to; if it is empty, the repository's default branch is used
+	Branch string
+	// Dir is the directory in the repository which contains index.yaml
+	Dir string
+	// ChartsURL is the URL under which Dir is served
+	ChartsURL string
+	// Auth is used to clone and push; it may be nil for local repositories
+	Auth transport.AuthMethod
+	// AuthorName and AuthorEmail default to DefaultChartAuthorName and DefaultChartAuthorEmail
+	AuthorName    string
+	AuthorEmail   string
+	CommitMessage string
+}
+
+// GetGitAuth returns the auth method for a Git repository; SSH repositories use sshKeyFile or the SSH agent if it is empty,
+// HTTP repositories use basic auth if username or password is set and local repositories don't use any auth
+func GetGitAuth(repositoryURL, username, password, sshKeyFile, sshKeyPassword string) (transport.AuthMethod, error) {
+	endpoint, err := transport.NewEndpoint(repositoryURL)
+	if err != nil {
+		return nil, err
 	}
 
+	switch endpoint.Protocol {
+	case "ssh":
+		user := endpoint.User
+		if user == "" {
+			user = "git"
+		}
+
+		if sshKeyFile == "" {
+			return ssh.NewSSHAgentAuth(user)
+		}
+
+		return ssh.NewPublicKeysFromFile(user, sshKeyFile, sshKeyPassword)
+	case "http", "https":
+		if username == "" && password == "" {
+			return nil, nil
+		}
+
+		return &http.BasicAuth{Username: username, Password: password}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// hasRemoteBranch returns true if the chart repository has commits on its branch, or on any branch if it has none
+func hasRemoteBranch(chartRepository GitChartRepository) (bool, error) {
+	refs, err := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{chartRepository.URL},
+	}).List(&git.ListOptions{Auth: chartRepository.Auth})
+	if err == transport.ErrEmptyRemoteRepository {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	for _, ref := range refs {
+		if chartRepository.Branch == "" && ref.Name().IsBranch() || ref.Name() == plumbing.NewBranchReferenceName(chartRepository.Branch) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func cloneOrInit(cloneDir string, chartRepository GitChartRepository) (*git.Repository, plumbing.ReferenceName, error) {
 	if err := os.RemoveAll(cloneDir); err != nil {
-		return err
+		return nil, "", err
+	}
+
+	exists, err := hasRemoteBranch(chartRepository)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if exists {
+		cloneOptions := &git.CloneOptions{
+			URL:      chartRepository.URL,
+			Auth:     chartRepository.Auth,
+			Progress: nil,
+		}
+		if chartRepository.Branch != "" {
+			cloneOptions.ReferenceName = plumbing.NewBranchReferenceName(chartRepository.Branch)
+			cloneOptions.SingleBranch = true
+		}
+
+		repository, err := git.PlainClone(cloneDir, false, cloneOptions)
+		if err != nil {
+			return nil, "", err
+		}
+
+		head, err := repository.Head()
+		if err != nil {
+			return nil, "", err
+		}
+
+		return repository, head.Name(), nil
 	}
 
-	if _, err := git.PlainClone(cloneDir, false, &git.CloneOptions{
-		URL:      githubRepositoryUrl,
-		Auth:     &http.BasicAuth{Username: githubUserName, Password: githubToken},
-		Progress: nil,
+	// The repository or branch does not have any commits yet, so start a new history
+	repository, err := git.PlainInit(cloneDir, false)
+	if err != nil {
+		return nil, "", err
+	}
+
+	branch := plumbing.Master
+	if chartRepository.Branch != "" {
+		branch = plumbing.NewBranchReferenceName(chartRepository.Branch)
+	}
+
+	if err := repository.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, branch)); err != nil {
+		return nil, "", err
+	}
+
+	if _, err := repository.CreateRemote(&config.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{chartRepository.URL},
 	}); err != nil {
+		return nil, "", err
+	}
+
+	return repository, branch, nil
+}
+
+// PushIndex uploads the charts in chartDist using backend, merges them into the index.yaml of the chart repository and pushes it.
+// If backend is nil, the charts are committed to the repository and served from its ChartsURL instead.
+func (h *HelmManager) PushIndex(backend ReleaseBackend, chartRepository GitChartRepository, chartDist, cloneDir string) error {
+	if backend == nil && chartRepository.ChartsURL == "" {
+		return errors.New("charts URL of " + chartRepository.URL + " is not set, so the charts can't be served from it")
+	}
+
+	charts, err := filepath.Glob(filepath.Join(chartDist, "*.tgz"))
+	if err != nil {
 		return err
 	}
 
-	updateIndexCommand := NewManageableCommand("cr index -o "+githubUserName+" -t "+githubToken+" -r "+githubRepositoryName+" -p "+chartDist+" -i "+filepath.Join(cloneDir, "index.yaml")+" -c "+githubPagesUrl, h.dir, h.stdoutChan, h.stderrChan)
+	if len(charts) == 0 {
+		return errors.New("no charts found in " + chartDist)
+	}
 
-	if err := updateIndexCommand.Start(); err != nil {
+	repository, branch, err := cloneOrInit(cloneDir, chartRepository)
+	if err != nil {
 		return err
 	}
 
-	if err := updateIndexCommand.Wait(); err != nil {
+	indexDir := filepath.Join(cloneDir, chartRepository.Dir)
+	if err := os.MkdirAll(indexDir, 0777); err != nil {
 		return err
 	}
 
-	g, err := git.PlainOpen(cloneDir)
-	if err != nil {
+	chartURLs := map[string]string{}
+	for _, chart := range charts {
+		loadedChart, err := loader.Load(chart)
+		if err != nil {
+			return &InvalidChartError{Chart: chart, Errors: []error{err}}
+		}
+
+		if backend == nil {
+			content, err := ioutil.ReadFile(chart)
+			if err != nil {
+				return err
+			}
+
+			if err := ioutil.WriteFile(filepath.Join(indexDir, filepath.Base(chart)), content, 0644); err != nil {
+				return err
+			}
+
+			chartURLs[chart] = strings.TrimSuffix(chartRepository.ChartsURL, "/") + "/" + filepath.Base(chart)
+
+			continue
+		}
+
+		// Use the same release names as chart-releaser, so that existing repositories keep working
+		chartURL, err := backend.Upload(loadedChart.Metadata.Name+"-"+loadedChart.Metadata.Version, chart)
+		if err != nil {
+			return err
+		}
+
+		chartURLs[chart] = chartURL
+	}
+
+	if err := h.UpdateIndex(filepath.Join(indexDir, "index.yaml"), chartURLs); err != nil {
 		return err
 	}
 
-	wt, err := g.Worktree()
+	wt, err := repository.Worktree()
 	if err != nil {
 		return err
 	}
@@ -93,17 +447,211 @@ func (h *HelmManager) Push(gitUserName, gitUserEmail, gitCommitMessage, githubUs
 		return err
 	}
 
-	if _, err = wt.Commit(gitCommitMessage, &git.CommitOptions{
-		Author: &object.Signature{
-			Name:  gitUserName,
-			Email: gitUserEmail,
-			When:  time.Now(),
-		},
+	author := &object.Signature{
+		Name:  chartRepository.AuthorName,
+		Email: chartRepository.AuthorEmail,
+		When:  time.Now(),
+	}
+	if author.Name == "" {
+		author.Name = DefaultChartAuthorName
+	}
+	if author.Email == "" {
+		author.Email = DefaultChartAuthorEmail
+	}
+
+	if _, err = wt.Commit(chartRepository.CommitMessage, &git.CommitOptions{
+		Author: author,
 	}); err != nil {
 		return err
 	}
 
-	return g.Push(&git.PushOptions{
-		Auth: &http.BasicAuth{Username: githubUserName, Password: githubToken},
+	return repository.Push(&git.PushOptions{
+		RemoteName: git.DefaultRemoteName,
+		RefSpecs:   []config.RefSpec{config.RefSpec(branch + ":" + branch)},
+		Auth:       chartRepository.Auth,
 	})
 }
+
+// Push releases a Helm chart using GitHub, GitHub releases and GitHub pages
+func (h *HelmManager) Push(gitUserName, gitUserEmail, gitCommitMessage, githubUserName, githubToken, githubRepositoryName, githubRepositoryUrl, githubPagesUrl, chartDist, cloneDir string) error {
+	return h.PushIndex(
+		NewGitHubReleaseBackend(GitHubAPIURL, GitHubUploadURL, githubUserName, githubRepositoryName, githubToken),
+		GitChartRepository{
+			URL:           githubRepositoryUrl,
+			ChartsURL:     githubPagesUrl,
+			Auth:          &http.BasicAuth{Username: githubUserName, Password: githubToken},
+			AuthorName:    gitUserName,
+			AuthorEmail:   gitUserEmail,
+			CommitMessage: gitCommitMessage,
+		},
+		chartDist,
+		cloneDir,
+	)
+}
+
+// PushOCI pushes the charts in chartDist to an OCI registry such as `oci://ghcr.io/pojntfx/charts`.
+// If username is empty, the credentials from the Docker config are used.
+func (h *HelmManager) PushOCI(chartDist, registryURL, username, password string, plainHTTP bool) error {
+	charts, err := filepath.Glob(filepath.Join(chartDist, "*.tgz"))
+	if err != nil {
+		return err
+	}
+
+	if len(charts) == 0 {
+		return errors.New("no charts found in " + chartDist)
+	}
+
+	if !strings.HasPrefix(registryURL, registry.OCIScheme+"://") {
+		return errors.New("invalid OCI registry URL " + registryURL + ", it must start with " + registry.OCIScheme + "://")
+	}
+	repository := strings.TrimSuffix(strings.TrimPrefix(registryURL, registry.OCIScheme+"://"), "/")
+
+	// Don't store the credentials in the user's Helm config
+	credentialsDir, err := ioutil.TempDir("", "dibs-registry-config")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(credentialsDir)
+
+	options := []registry.ClientOption{
+		registry.ClientOptWriter(&chanWriter{h.stdoutChan}),
+		registry.ClientOptCredentialsFile(filepath.Join(credentialsDir, "config.json")),
+	}
+	if plainHTTP {
+		options = append(options, registry.ClientOptPlainHTTP())
+	}
+
+	client, err := registry.NewClient(options...)
+	if err != nil {
+		return err
+	}
+
+	if username != "" {
+		if err := client.Login(strings.SplitN(repository, "/", 2)[0], registry.LoginOptBasicAuth(username, password), registry.LoginOptInsecure(plainHTTP)); err != nil {
+			return err
+		}
+	}
+
+	for _, chart := range charts {
+		loadedChart, err := loader.Load(chart)
+		if err != nil {
+			return &InvalidChartError{Chart: chart, Errors: []error{err}}
+		}
+
+		content, err := ioutil.ReadFile(chart)
+		if err != nil {
+			return err
+		}
+
+		if _, err := client.Push(content, repository+"/"+loadedChart.Metadata.Name+":"+loadedChart.Metadata.Version); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateManifest(manifest string) error {
+	deserializer := kjson.NewSerializerWithOptions(kjson.DefaultMetaFactory, scheme.Scheme, scheme.Scheme, kjson.SerializerOptions{
+		Yaml:   true,
+		Strict: true,
+	})
+
+	_, gvk, err := deserializer.Decode([]byte(manifest), nil, nil)
+	if err != nil && runtime.IsNotRegisteredError(err) && gvk != nil && gvk.Kind != "" {
+		// There are no schemas for custom resources without a cluster, so only built-in kinds can be validated
+		return nil
+	}
+
+	return err
+}
+
+// Verify lints a Helm chart, renders its templates with each values file (or the default values if there are none) and the
+// values to set (such as `image=pojntfx/test-app:linux-amd64`) and validates the rendered manifests against the Kubernetes object schemas
+func (h *HelmManager) Verify(src string, valuesFiles, setValues []string) error {
+	out := &chanWriter{h.stdoutChan}
+
+	loadedChart, err := loader.Load(src)
+	if err != nil {
+		return &InvalidChartError{Chart: src, Errors: []error{err}}
+	}
+
+	if len(valuesFiles) == 0 {
+		valuesFiles = []string{""}
+	}
+
+	var errs []error
+	for _, valuesFile := range valuesFiles {
+		values := map[string]interface{}{}
+		if valuesFile != "" {
+			values, err = chartutil.ReadValuesFile(valuesFile)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, setValue := range setValues {
+			if err := strvals.ParseInto(setValue, values); err != nil {
+				return err
+			}
+		}
+
+		name := src
+		if valuesFile != "" {
+			name += " with " + valuesFile
+		}
+
+		lint := action.NewLint()
+		lintResult := lint.Run([]string{src}, values)
+		for _, message := range lintResult.Messages {
+			if message.Severity < support.ErrorSev {
+				out.Write([]byte(message.Error()))
+			}
+		}
+		if len(lintResult.Errors) > 0 {
+			errs = append(errs, lintResult.Errors...)
+
+			continue
+		}
+
+		install := action.NewInstall(&action.Configuration{Log: func(string, ...interface{}) {}})
+		install.DryRun = true
+		install.ClientOnly = true
+		install.Replace = true
+		install.IncludeCRDs = true
+		install.ReleaseName = loadedChart.Metadata.Name
+		install.Namespace = "default"
+
+		release, err := install.Run(loadedChart, values)
+		if err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		manifests := releaseutil.SplitManifests(release.Manifest)
+		keys := make([]string, 0, len(manifests))
+		for key := range manifests {
+			keys = append(keys, key)
+		}
+		sort.Sort(releaseutil.BySplitManifestsOrder(keys))
+
+		for _, key := range keys {
+			if strings.TrimSpace(manifests[key]) == "" {
+				continue
+			}
+
+			if err := validateManifest(manifests[key]); err != nil {
+				errs = append(errs, errors.New(name+": "+err.Error()))
+			}
+		}
+
+		out.Write([]byte("Verified " + strconv.Itoa(len(keys)) + " rendered manifests of " + name))
+	}
+
+	if len(errs) > 0 {
+		return &InvalidChartError{Chart: src, Errors: errs}
+	}
+
+	return nil
+}
@@ -1,9 +1,17 @@
 package utils
 
 import (
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/repo"
 )
 
 var (
@@ -58,7 +66,7 @@ func TestBuildHelmManager(t *testing.T) {
 		}
 	}()
 
-	if err := h.Build(testHelmChartSrc, testHelmChartDist); err != nil {
+	if err := h.Build(testHelmChartSrc, testHelmChartDist, "", nil); err != nil {
 		t.Error(err)
 	}
 
@@ -72,6 +80,501 @@ func TestBuildHelmManager(t *testing.T) {
 	}
 }
 
+func TestBuildVersionHelmManager(t *testing.T) {
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+
+	h := NewHelmManager(testContext, stdoutChan, stderrChan)
+
+	if err := os.RemoveAll(testHelmChartDist); err != nil {
+		t.Error(err)
+	}
+
+	go func() {
+		for {
+			select {
+			case stdout := <-stdoutChan:
+				t.Log("test stdout", stdout)
+			case stderr := <-stderrChan:
+				t.Error("error while building Helm chart", stderr)
+			}
+		}
+	}()
+
+	if err := h.Build(testHelmChartSrc, testHelmChartDist, "v1.2.3", nil); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(testHelmChartDist, "test-app-1.2.3.tgz")); err != nil {
+		t.Error("Built Helm chart does not have the stamped version", err)
+	}
+}
+
+func TestBuildSetValuesHelmManager(t *testing.T) {
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+
+	h := NewHelmManager(testContext, stdoutChan, stderrChan)
+
+	if err := os.RemoveAll(testHelmChartDist); err != nil {
+		t.Error(err)
+	}
+
+	go func() {
+		for {
+			select {
+			case stdout := <-stdoutChan:
+				t.Log("test stdout", stdout)
+			case stderr := <-stderrChan:
+				t.Error("error while building Helm chart", stderr)
+			}
+		}
+	}()
+
+	image := testManifestTag + "@sha256:bfce9a091e8c12095a98008ef157129360d67b1d6f0fca9645aed04cff8b65c9"
+	if err := h.Build(testHelmChartSrc, testHelmChartDist, "v1.2.4", []string{"image=" + image}); err != nil {
+		t.Fatal(err)
+	}
+
+	builtChart, err := loader.Load(filepath.Join(testHelmChartDist, "test-app-1.2.4.tgz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if builtChart.Values["image"] != image {
+		t.Error("image not written into the chart's values", builtChart.Values["image"])
+	}
+
+	if builtChart.Values["debugPort"] == nil {
+		t.Error("other values have not been kept")
+	}
+
+	sourceChart, err := loader.Load(testHelmChartSrc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sourceChart.Values["image"] == image {
+		t.Error("image has been written into the chart's source")
+	}
+}
+
+func TestBuildInvalidChartHelmManager(t *testing.T) {
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+
+	h := NewHelmManager(testContext, stdoutChan, stderrChan)
+
+	invalidChartSrc := filepath.Join(os.TempDir(), "test-invalid-chart")
+	if err := os.RemoveAll(invalidChartSrc); err != nil {
+		t.Error(err)
+	}
+
+	if err := os.MkdirAll(invalidChartSrc, 0777); err != nil {
+		t.Error(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(invalidChartSrc, "Chart.yaml"), []byte("apiVersion: v2\nname: test-invalid-chart\n"), 0666); err != nil {
+		t.Error(err)
+	}
+
+	go func() {
+		for {
+			select {
+			case stdout := <-stdoutChan:
+				t.Log("test stdout", stdout)
+			case stderr := <-stderrChan:
+				t.Log("test stderr", stderr)
+			}
+		}
+	}()
+
+	err := h.Build(invalidChartSrc, testHelmChartDist, "", nil)
+	if _, ok := err.(*InvalidChartError); !ok {
+		t.Error("Building an invalid chart did not return an InvalidChartError", err)
+	}
+}
+
+func setupBareRepository(t *testing.T, name string) string {
+	bareRepository := filepath.Join(os.TempDir(), name)
+	if err := os.RemoveAll(bareRepository); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := git.PlainInit(bareRepository, true); err != nil {
+		t.Fatal(err)
+	}
+
+	return bareRepository
+}
+
+func TestPushIndexHelmManager(t *testing.T) {
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+
+	h := NewHelmManager(testContext, stdoutChan, stderrChan)
+
+	go func() {
+		for {
+			select {
+			case stdout := <-stdoutChan:
+				t.Log("test stdout", stdout)
+			case stderr := <-stderrChan:
+				t.Error("error while building or pushing Helm chart", stderr)
+			}
+		}
+	}()
+
+	bareRepository := setupBareRepository(t, "test-charts-repo.git")
+
+	if err := h.PushIndex(nil, GitChartRepository{URL: bareRepository}, testHelmChartDist, testCloneDir); err == nil {
+		t.Error("chart repository without a charts URL did not return an error")
+	}
+
+	for _, version := range []string{"v1.0.0", "v1.1.0"} {
+		if err := os.RemoveAll(testHelmChartDist); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := h.Build(testHelmChartSrc, testHelmChartDist, version, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := h.PushIndex(nil, GitChartRepository{
+			URL:           bareRepository,
+			ChartsURL:     "https://example.com/charts/",
+			AuthorName:    "dibs",
+			AuthorEmail:   "dibs@example.com",
+			CommitMessage: "chore: Update Helm charts",
+		}, testHelmChartDist, testCloneDir); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	verifyDir := filepath.Join(os.TempDir(), "test-charts-repo-verify")
+	if err := os.RemoveAll(verifyDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := git.PlainClone(verifyDir, false, &git.CloneOptions{URL: bareRepository}); err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := repo.LoadIndexFile(filepath.Join(verifyDir, "index.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(index.Entries["test-app"]) != 2 {
+		t.Fatal("index does not contain both chart versions", index.Entries["test-app"])
+	}
+
+	chart, err := index.Get("test-app", "1.1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if chart.URLs[0] != "https://example.com/charts/test-app-1.1.0.tgz" {
+		t.Error("chart URL not set correctly", chart.URLs)
+	}
+
+	if chart.Digest == "" || chart.Created.IsZero() {
+		t.Error("chart digest or created timestamp not set")
+	}
+
+	if _, err := os.Stat(filepath.Join(verifyDir, "test-app-1.1.0.tgz")); err != nil {
+		t.Error("chart has not been committed to the repository", err)
+	}
+}
+
+func TestPushIndexBranchAndDirHelmManager(t *testing.T) {
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+
+	h := NewHelmManager(testContext, stdoutChan, stderrChan)
+
+	go func() {
+		for {
+			select {
+			case stdout := <-stdoutChan:
+				t.Log("test stdout", stdout)
+			case stderr := <-stderrChan:
+				t.Error("error while building or pushing Helm chart", stderr)
+			}
+		}
+	}()
+
+	bareRepository := setupBareRepository(t, "test-charts-branch-repo.git")
+
+	// Create an unrelated default branch, so that the pages branch has to be created
+	if err := h.Build(testHelmChartSrc, testHelmChartDist, "v0.9.0", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	chartRepository := GitChartRepository{
+		URL:           bareRepository,
+		Dir:           "docs",
+		ChartsURL:     "https://example.com/charts/",
+		AuthorName:    "dibs",
+		AuthorEmail:   "dibs@example.com",
+		CommitMessage: "chore: Update Helm charts",
+	}
+
+	if err := h.PushIndex(nil, chartRepository, testHelmChartDist, testCloneDir); err != nil {
+		t.Fatal(err)
+	}
+
+	chartRepository.Branch = "gh-pages"
+	chartRepository.Dir = "charts"
+
+	for i := 0; i < 2; i++ {
+		if err := h.PushIndex(nil, chartRepository, testHelmChartDist, testCloneDir); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	verifyDir := filepath.Join(os.TempDir(), "test-charts-branch-repo-verify")
+	if err := os.RemoveAll(verifyDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := git.PlainClone(verifyDir, false, &git.CloneOptions{
+		URL:           bareRepository,
+		ReferenceName: plumbing.NewBranchReferenceName("gh-pages"),
+		SingleBranch:  true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repo.LoadIndexFile(filepath.Join(verifyDir, "charts", "index.yaml")); err != nil {
+		t.Error("index has not been pushed to the branch's directory", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(verifyDir, "docs")); err == nil {
+		t.Error("branch contains files from the default branch")
+	}
+}
+
+func TestGetGitAuth(t *testing.T) {
+	auth, err := GetGitAuth("https://github.com/pojntfx/charts.git", "pojntfx", "token", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := auth.(*http.BasicAuth); !ok {
+		t.Error("HTTP repository does not use basic auth", auth)
+	}
+
+	auth, err = GetGitAuth("/srv/charts.git", "", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if auth != nil {
+		t.Error("local repository uses auth", auth)
+	}
+
+	if _, err := GetGitAuth("git@github.com:pojntfx/charts.git", "", "", filepath.Join(os.TempDir(), "does-not-exist"), ""); err == nil {
+		t.Error("missing SSH key did not return an error")
+	}
+}
+
+type testReleaseBackend struct {
+	uploads map[string]string
+}
+
+func (b *testReleaseBackend) Upload(tag, file string) (string, error) {
+	b.uploads[tag] = file
+
+	return "https://example.com/releases/download/" + tag + "/" + filepath.Base(file), nil
+}
+
+func TestPushIndexReleaseBackendHelmManager(t *testing.T) {
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+
+	h := NewHelmManager(testContext, stdoutChan, stderrChan)
+
+	go func() {
+		for {
+			select {
+			case stdout := <-stdoutChan:
+				t.Log("test stdout", stdout)
+			case stderr := <-stderrChan:
+				t.Error("error while building or pushing Helm chart", stderr)
+			}
+		}
+	}()
+
+	bareRepository := setupBareRepository(t, "test-charts-release-repo.git")
+
+	if err := os.RemoveAll(testHelmChartDist); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.Build(testHelmChartSrc, testHelmChartDist, "v2.0.0", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The commits are made with the default author if none is set
+	backend := &testReleaseBackend{map[string]string{}}
+	if err := h.PushIndex(backend, GitChartRepository{
+		URL:           bareRepository,
+		CommitMessage: "chore: Update Helm charts",
+	}, testHelmChartDist, testCloneDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := backend.uploads["test-app-2.0.0"]; !ok {
+		t.Error("chart has not been uploaded to a release", backend.uploads)
+	}
+
+	index, err := repo.LoadIndexFile(filepath.Join(testCloneDir, "index.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chart, err := index.Get("test-app", "2.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if chart.URLs[0] != "https://example.com/releases/download/test-app-2.0.0/test-app-2.0.0.tgz" {
+		t.Error("chart URL does not point to the release asset", chart.URLs)
+	}
+
+	repository, err := git.PlainOpen(testCloneDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	head, err := repository.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commit, err := repository.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if commit.Author.Name != DefaultChartAuthorName || commit.Author.Email != DefaultChartAuthorEmail {
+		t.Error("commit author is", commit.Author, "expected the default author")
+	}
+}
+
+func TestPushOCIHelmManager(t *testing.T) {
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+
+	h := NewHelmManager(testContext, stdoutChan, stderrChan)
+
+	go func() {
+		for {
+			select {
+			case stdout := <-stdoutChan:
+				t.Log("test stdout", stdout)
+			case stderr := <-stderrChan:
+				t.Error("error while building or pushing Helm chart", stderr)
+			}
+		}
+	}()
+
+	registry, server := newTestOCIRegistry("dibs", "test-password")
+	defer server.Close()
+
+	if err := os.RemoveAll(testHelmChartDist); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.Build(testHelmChartSrc, testHelmChartDist, "v3.0.0", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	registryURL := "oci://" + strings.TrimPrefix(server.URL, "http://") + "/pojntfx/charts"
+
+	if err := h.PushOCI(testHelmChartDist, registryURL, "dibs", "wrong-password", true); err == nil {
+		t.Error("pushing with invalid credentials did not return an error")
+	}
+
+	if err := h.PushOCI(testHelmChartDist, registryURL, "dibs", "test-password", true); err != nil {
+		t.Fatal(err)
+	}
+
+	if !registry.hasManifest("pojntfx/charts/test-app:3.0.0") {
+		t.Error("chart has not been pushed to the registry")
+	}
+
+	if err := h.PushOCI(testHelmChartDist, "https://example.com/charts", "", "", true); err == nil {
+		t.Error("invalid registry URL did not return an error")
+	}
+}
+
+func TestVerifyHelmManager(t *testing.T) {
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+
+	h := NewHelmManager(testContext, stdoutChan, stderrChan)
+
+	go func() {
+		for {
+			select {
+			case stdout := <-stdoutChan:
+				t.Log("test stdout", stdout)
+			case stderr := <-stderrChan:
+				t.Error("error while verifying Helm chart", stderr)
+			}
+		}
+	}()
+
+	devValuesFile := filepath.Join(os.TempDir(), "test-app-dev-values.yaml")
+	if err := ioutil.WriteFile(devValuesFile, []byte("dev: true\ndebug: true\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.Verify(testHelmChartSrc, []string{filepath.Join(testHelmChartSrc, "values.yaml"), devValuesFile}, []string{"image=" + testTag}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVerifyInvalidManifestHelmManager(t *testing.T) {
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+
+	h := NewHelmManager(testContext, stdoutChan, stderrChan)
+
+	go func() {
+		for {
+			select {
+			case stdout := <-stdoutChan:
+				t.Log("test stdout", stdout)
+			case stderr := <-stderrChan:
+				t.Log("test stderr", stderr)
+			}
+		}
+	}()
+
+	invalidChartSrc := filepath.Join(os.TempDir(), "test-invalid-manifest-chart")
+	if err := os.RemoveAll(invalidChartSrc); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(invalidChartSrc, "templates"), 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	for file, content := range map[string]string{
+		"Chart.yaml":                "apiVersion: v2\nname: test-invalid-manifest-chart\nversion: 0.0.1\n",
+		"values.yaml":               "replicas: 1\n",
+		"templates/deployment.yaml": "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: test\nspec:\n  replicaz: {{ .Values.replicas }}\n  selector:\n    matchLabels:\n      app: test\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(invalidChartSrc, file), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := h.Verify(invalidChartSrc, nil, nil)
+	invalidChartError, ok := err.(*InvalidChartError)
+	if !ok {
+		t.Fatal("Verifying a chart with an invalid manifest did not return an InvalidChartError", err)
+	}
+
+	if !strings.Contains(invalidChartError.Error(), "replicaz") {
+		t.Error("error does not mention the invalid field", invalidChartError)
+	}
+}
+
 // TestPushHelmManager requires the environment variables below to be set; it is disabled by default.
 func TestPushHelmManager(t *testing.T) {
 	if os.Getenv("DIBS_HELM_PUSH_TEST_ENABLED") == "1" {
@@ -98,7 +601,7 @@ func TestPushHelmManager(t *testing.T) {
 			}
 		}()
 
-		if err := h.Build(testHelmChartSrc, testHelmChartDist); err != nil {
+		if err := h.Build(testHelmChartSrc, testHelmChartDist, "", nil); err != nil {
 			t.Error(err)
 		}
 
@@ -0,0 +1,330 @@
+package utils
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+const (
+	// InitCommonTemplate is the template whose files are generated for all languages; the files of a language override them
+	InitCommonTemplate = "common"
+
+	// initNamePlaceholder is replaced with the project's name in the paths of the templates' files
+	initNamePlaceholder = "__name__"
+	// initPartialPrefix is the prefix of files which define templates for the other files instead of being generated
+	initPartialPrefix = "_"
+)
+
+// The templates use `[[` and `]]` as delimiters so that they don't clash with Helm's templates
+var (
+	initLeftDelim, initRightDelim = "[[", "]]"
+
+	initNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+)
+
+//go:embed all:templates
+var embeddedInitTemplates embed.FS
+
+// InitPlatform is a platform of a generated project
+type InitPlatform struct {
+	// Name is the name of the project
+	Name string
+	// Identifier is the platform's identifier, e.g. `linux/arm/v7`
+	Identifier string
+	OS         string
+	Arch       string
+	Variant    string
+	// Suffix is used in the names of assets and the tags of images, e.g. `linux-arm-v7`
+	Suffix string
+	// Asset is the name of the built binary, e.g. `app-linux-arm-v7`
+	Asset string
+	// Repository is the repository of the platform's images, e.g. `pojntfx/app`
+	Repository string
+	// Docker is true if images are built for the platform
+	Docker bool
+}
+
+// InitTarget is a target of a generated project; there is one for each OS
+type InitTarget struct {
+	Name      string
+	Docker    bool
+	Platforms []InitPlatform
+}
+
+// InitData is passed to the templates of a generated project
+type InitData struct {
+	Name     string
+	Image    string
+	Language string
+	Targets  []InitTarget
+}
+
+// NewInitData creates the InitData of a project; image defaults to name
+func NewInitData(name, image, language string, platforms []string) (InitData, error) {
+	if !initNameRegexp.MatchString(name) {
+		return InitData{}, errors.New("invalid project name " + name + ", use lowercase letters, digits and dashes")
+	}
+
+	if image == "" {
+		image = name
+	}
+
+	if len(platforms) == 0 {
+		return InitData{}, errors.New("at least one platform is required")
+	}
+
+	data := InitData{Name: name, Image: image, Language: language}
+	for _, identifier := range platforms {
+		parts := strings.Split(identifier, "/")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			return InitData{}, errors.New("invalid platform " + identifier + ", use an identifier such as linux/amd64 or linux/arm/v7")
+		}
+
+		platform := InitPlatform{
+			Name:       name,
+			Identifier: identifier,
+			OS:         parts[0],
+			Arch:       parts[1],
+			Suffix:     strings.Join(parts, "-"),
+			Repository: image,
+			// Docker images are only built for Linux
+			Docker: parts[0] == "linux",
+		}
+		if len(parts) == 3 {
+			platform.Variant = parts[2]
+		}
+
+		platform.Asset = name + "-" + platform.Suffix
+		if platform.OS == "windows" {
+			platform.Asset += ".exe"
+		}
+
+		found := false
+		for i, target := range data.Targets {
+			if target.Name == platform.OS {
+				data.Targets[i].Platforms = append(data.Targets[i].Platforms, platform)
+				found = true
+
+				break
+			}
+		}
+
+		if !found {
+			data.Targets = append(data.Targets, InitTarget{
+				Name:      platform.OS,
+				Docker:    platform.Docker,
+				Platforms: []InitPlatform{platform},
+			})
+		}
+	}
+
+	return data, nil
+}
+
+// InitManager generates new projects from templates
+type InitManager struct {
+	dir                    string
+	stdoutChan, stderrChan chan string
+	templates              []fs.FS
+}
+
+// NewInitManager creates a new InitManager; the files in templatesDir, if set, override the embedded templates' files with the same paths
+func NewInitManager(dir, templatesDir string, stdoutChan, stderrChan chan string) *InitManager {
+	// The embedded FS always contains the templates dir
+	embeddedTemplates, _ := fs.Sub(embeddedInitTemplates, "templates")
+
+	templates := []fs.FS{embeddedTemplates}
+	if templatesDir != "" {
+		templates = append(templates, os.DirFS(templatesDir))
+	}
+
+	return &InitManager{
+		dir:        dir,
+		stdoutChan: stdoutChan,
+		stderrChan: stderrChan,
+		templates:  templates,
+	}
+}
+
+// GetLanguages returns the languages which there are templates for
+func (i *InitManager) GetLanguages() ([]string, error) {
+	languages := map[string]bool{}
+	for _, templates := range i.templates {
+		entries, err := fs.ReadDir(templates, ".")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() && entry.Name() != InitCommonTemplate {
+				languages[entry.Name()] = true
+			}
+		}
+	}
+
+	var sortedLanguages []string
+	for language := range languages {
+		sortedLanguages = append(sortedLanguages, language)
+	}
+	sort.Strings(sortedLanguages)
+
+	return sortedLanguages, nil
+}
+
+// getFiles returns the contents of the files of the common template and the language's template by their paths
+func (i *InitManager) getFiles(language string) (map[string]string, error) {
+	files := map[string]string{}
+	languageFound := false
+
+	for _, templates := range i.templates {
+		for _, templateName := range []string{InitCommonTemplate, language} {
+			if _, err := fs.Stat(templates, templateName); err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					continue
+				}
+
+				return nil, err
+			}
+
+			if templateName == language {
+				languageFound = true
+			}
+
+			if err := fs.WalkDir(templates, templateName, func(filePath string, entry fs.DirEntry, err error) error {
+				if err != nil || entry.IsDir() {
+					return err
+				}
+
+				content, err := fs.ReadFile(templates, filePath)
+				if err != nil {
+					return err
+				}
+
+				files[strings.TrimPrefix(filePath, templateName+"/")] = string(content)
+
+				return nil
+			}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if !languageFound {
+		languages, err := i.GetLanguages()
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, errors.New("unknown language " + language + ", use one of " + strings.Join(languages, ", "))
+	}
+
+	return files, nil
+}
+
+func isInitPartial(filePath string) bool {
+	name := path.Base(filePath)
+
+	return strings.HasPrefix(name, initPartialPrefix) && !strings.HasPrefix(name, initNamePlaceholder)
+}
+
+// Render renders the templates of language and returns the generated files by their paths
+func (i *InitManager) Render(language string, data InitData) (map[string]string, error) {
+	files, err := i.getFiles(language)
+	if err != nil {
+		return nil, err
+	}
+
+	var partials []string
+	for filePath := range files {
+		if isInitPartial(filePath) {
+			partials = append(partials, filePath)
+		}
+	}
+	sort.Strings(partials)
+
+	rendered := map[string]string{}
+	for filePath, content := range files {
+		if isInitPartial(filePath) {
+			continue
+		}
+
+		tmpl, err := template.New(filePath).
+			Delims(initLeftDelim, initRightDelim).
+			Funcs(template.FuncMap{"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) }}).
+			Option("missingkey=error").
+			Parse(content)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, partial := range partials {
+			if _, err := tmpl.New(partial).Parse(files[partial]); err != nil {
+				return nil, err
+			}
+		}
+
+		out := &bytes.Buffer{}
+		if err := tmpl.Execute(out, data); err != nil {
+			return nil, err
+		}
+
+		rendered[strings.ReplaceAll(filePath, initNamePlaceholder, data.Name)] = out.String()
+	}
+
+	return rendered, nil
+}
+
+// Init generates a project from the templates of language in the manager's dir and returns the paths of the written files.
+// If any of the files exist already, nothing is written unless force is set.
+func (i *InitManager) Init(language string, data InitData, force bool) ([]string, error) {
+	files, err := i.Render(language, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var filePaths []string
+	for filePath := range files {
+		filePaths = append(filePaths, filePath)
+	}
+	sort.Strings(filePaths)
+
+	if !force {
+		var existing []string
+		for _, filePath := range filePaths {
+			if _, err := os.Stat(filepath.Join(i.dir, filepath.FromSlash(filePath))); err == nil {
+				existing = append(existing, filePath)
+			}
+		}
+
+		if len(existing) > 0 {
+			return nil, errors.New("refusing to overwrite " + strings.Join(existing, ", ") + ", use force to overwrite them")
+		}
+	}
+
+	var written []string
+	for _, filePath := range filePaths {
+		out := filepath.Join(i.dir, filepath.FromSlash(filePath))
+
+		if err := os.MkdirAll(filepath.Dir(out), 0777); err != nil {
+			return written, err
+		}
+
+		if err := ioutil.WriteFile(out, []byte(files[filePath]), 0666); err != nil {
+			return written, err
+		}
+
+		written = append(written, out)
+	}
+
+	return written, nil
+}
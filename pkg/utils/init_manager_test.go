@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestNewInitData(t *testing.T) {
+	data, err := NewInitData("test-app", "pojntfx/test-app", "go", []string{"linux/amd64", "linux/arm/v7", "darwin/arm64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(data.Targets) != 2 || data.Targets[0].Name != "linux" || !data.Targets[0].Docker || data.Targets[1].Docker {
+		t.Fatalf("targets are %+v, expected linux with Docker and darwin without it", data.Targets)
+	}
+
+	platform := data.Targets[0].Platforms[1]
+	if platform.Variant != "v7" || platform.Asset != "test-app-linux-arm-v7" || platform.Repository != "pojntfx/test-app" {
+		t.Errorf("platform is %+v, expected variant v7 and asset test-app-linux-arm-v7", platform)
+	}
+
+	for _, invalid := range [][]string{
+		{"Test App", "linux/amd64"},
+		{"test-app", "linux"},
+		{"test-app"},
+	} {
+		if _, err := NewInitData(invalid[0], "", "go", invalid[1:]); err == nil {
+			t.Errorf("invalid project %v did not return an error", invalid)
+		}
+	}
+}
+
+func TestInitManager(t *testing.T) {
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+
+	go func() {
+		for {
+			select {
+			case stdout := <-stdoutChan:
+				t.Log("test stdout", stdout)
+			case stderr := <-stderrChan:
+				t.Log("test stderr", stderr)
+			}
+		}
+	}()
+
+	languages, err := NewInitManager("", "", stdoutChan, stderrChan).GetLanguages()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "c, go, node, python, rust"; strings.Join(languages, ", ") != expected {
+		t.Errorf("languages are %v, expected %v", languages, expected)
+	}
+
+	for _, language := range languages {
+		dir, err := ioutil.TempDir("", "dibs-init-*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		data, err := NewInitData("test-app", "pojntfx/test-app", language, []string{"linux/amd64", "linux/arm64", "darwin/amd64"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		i := NewInitManager(dir, "", stdoutChan, stderrChan)
+
+		written, err := i.Init(language, data, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, file := range []string{"dibs.yaml", ".dockerignore", "Dockerfile", "Dockerfile.unitTests", "Dockerfile.integrationTests", "Dockerfile.chartTests", "charts/test-app/Chart.yaml"} {
+			content, err := ioutil.ReadFile(filepath.Join(dir, file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if strings.Contains(string(content), initLeftDelim) {
+				t.Errorf("%v of %v contains unrendered templates", file, language)
+			}
+		}
+
+		config := map[string]interface{}{}
+		content, err := ioutil.ReadFile(filepath.Join(dir, "dibs.yaml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := yaml.Unmarshal(content, &config); err != nil {
+			t.Errorf("dibs.yaml of %v is invalid: %v", language, err)
+		}
+
+		if err := NewHelmManager(dir, stdoutChan, stderrChan).Verify(filepath.Join(dir, "charts", "test-app"), nil, nil); err != nil {
+			t.Errorf("chart of %v is invalid: %v", language, err)
+		}
+
+		if _, err := i.Init(language, data, false); err == nil {
+			t.Errorf("%v overwrote the %v existing files", language, len(written))
+		}
+
+		if _, err := i.Init(language, data, true); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestInitManagerTemplatesDir(t *testing.T) {
+	templatesDir, err := ioutil.TempDir("", "dibs-init-templates-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(templatesDir)
+
+	for name, content := range map[string]string{
+		"go/Dockerfile":   "FROM [[ .Image ]]\n",
+		"zig/_dibs.yaml":  `[[ define "paths" ]][[ end ]][[ define "commands" ]]` + "\n          build: zig build[[ end ]][[ define \"dockerignore\" ]][[ end ]]",
+		"zig/Dockerfile":  "FROM alpine\n",
+		"common/NOTES.md": "# [[ .Name ]]\n",
+	} {
+		if err := os.MkdirAll(filepath.Join(templatesDir, filepath.Dir(name)), 0777); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(templatesDir, name), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	i := NewInitManager("", templatesDir, nil, nil)
+
+	languages, err := i.GetLanguages()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "c, go, node, python, rust, zig"; strings.Join(languages, ", ") != expected {
+		t.Errorf("languages are %v, expected %v", languages, expected)
+	}
+
+	data, err := NewInitData("test-app", "pojntfx/test-app", "go", []string{"linux/amd64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := i.Render("go", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if files["Dockerfile"] != "FROM pojntfx/test-app\n" || files["NOTES.md"] != "# test-app\n" {
+		t.Errorf("overridden files are %q and %q", files["Dockerfile"], files["NOTES.md"])
+	}
+
+	files, err = i.Render("zig", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(files["dibs.yaml"], "build: zig build") {
+		t.Errorf("dibs.yaml of the added language is %q", files["dibs.yaml"])
+	}
+
+	if _, err := i.Render("java", data); err == nil {
+		t.Error("unknown language did not return an error")
+	}
+}
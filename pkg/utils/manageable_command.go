@@ -5,16 +5,29 @@ import (
 	"io"
 	"os"
 	"os/exec"
-	"runtime"
+	"sync"
 	"syscall"
+	"time"
 )
 
+// outputWaitDelay is the maximum time for which Wait waits for the output of a command which has exited to be sent to the chans
+const outputWaitDelay = time.Second
+
 // ManageableCommand is a manageable command
 type ManageableCommand struct {
 	execLine               string
 	stdoutChan, stderrChan chan string
 	dir                    string
+	env                    []string
 	instance               *exec.Cmd
+	waitOnce               *sync.Once
+	stopTimeout            time.Duration
+	// readers is done once all output of the command has been sent to the chans
+	readers *sync.WaitGroup
+	// processState is set once the command has been waited for
+	processState *os.ProcessState
+	// stateLock must be held while instance, waitOnce, readers or processState are accessed, as the state of a command is read concurrently, e.g. by CommandFlow.GetStatus
+	stateLock sync.Mutex
 }
 
 // NewManageableCommand creates a new ManageableCommand
@@ -27,7 +40,9 @@ func NewManageableCommand(execLine, dir string, stdoutChan chan string, stderrCh
 	}
 }
 
-func readFromReader(reader io.Reader, outChan chan string) {
+func readFromReader(reader io.Reader, outChan chan string, readers *sync.WaitGroup) {
+	defer readers.Done()
+
 	bufStdout := bufio.NewReader(reader)
 
 	for {
@@ -48,30 +63,81 @@ func getCommandWrappedInSh(execLine string) *exec.Cmd {
 
 // Start starts the command
 func (r *ManageableCommand) Start() error {
-	r.instance = getCommandWrappedInSh(r.execLine)
+	instance := getCommandWrappedInSh(r.execLine)
 	// TODO: Add test that checks if command gets executed in the set dir
-	r.instance.Dir = r.dir
+	instance.Dir = r.dir
+	if len(r.env) > 0 {
+		instance.Env = append(os.Environ(), r.env...)
+	}
 
-	stdout, err := r.instance.StdoutPipe()
+	stdout, err := instance.StdoutPipe()
 	if err != nil {
 		return err
 	}
-	stderr, err := r.instance.StderrPipe()
+	stderr, err := instance.StderrPipe()
 	if err != nil {
 		return err
 	}
 
-	go readFromReader(stdout, r.stdoutChan)
-	go readFromReader(stderr, r.stderrChan)
+	readers := &sync.WaitGroup{}
+	readers.Add(2)
+	go readFromReader(stdout, r.stdoutChan, readers)
+	go readFromReader(stderr, r.stderrChan, readers)
+
+	instance.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 
-	r.instance.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	err = instance.Start()
 
-	return r.instance.Start()
+	r.stateLock.Lock()
+	r.instance, r.processState, r.waitOnce, r.readers = instance, nil, &sync.Once{}, readers
+	r.stateLock.Unlock()
+
+	return err
 }
 
-// Wait waits for the command to complete
+func (r *ManageableCommand) getInstance() *exec.Cmd {
+	r.stateLock.Lock()
+	defer r.stateLock.Unlock()
+
+	return r.instance
+}
+
+// Wait waits for the command to complete; it may be called concurrently, but only the first call returns the command's error.
+// Commands which have not been started, e.g. skipped stages, return right away.
 func (r *ManageableCommand) Wait() error {
-	if err := r.instance.Wait(); err != nil && err.Error() != "signal: killed" && err.Error() != "exec: Wait was already called" {
+	r.stateLock.Lock()
+	instance, waitOnce, readers := r.instance, r.waitOnce, r.readers
+	r.stateLock.Unlock()
+
+	if waitOnce == nil {
+		return nil
+	}
+
+	var err error
+	waitOnce.Do(func() {
+		// The pipes are closed by Wait, so the remaining output has to be read first;
+		// this is limited by outputWaitDelay, as nobody might be receiving from the chans
+		readersDone := make(chan struct{})
+		go func() {
+			readers.Wait()
+
+			close(readersDone)
+		}()
+
+		select {
+		case <-readersDone:
+		case <-time.After(outputWaitDelay):
+		}
+
+		err = instance.Wait()
+
+		// ProcessState is written by Wait, so it is copied to be read concurrently
+		r.stateLock.Lock()
+		r.processState = instance.ProcessState
+		r.stateLock.Unlock()
+	})
+
+	if err != nil && err.Error() != "signal: killed" && err.Error() != "signal: terminated" {
 		return err
 	}
 
@@ -83,7 +149,12 @@ func (r *ManageableCommand) Wait() error {
 func (r *ManageableCommand) Stop() error {
 	noSuchProcessError := "no such process"
 
-	processGroupID, err := syscall.Getpgid(r.instance.Process.Pid)
+	instance := r.getInstance()
+	if instance == nil || instance.Process == nil {
+		return nil
+	}
+
+	processGroupID, err := syscall.Getpgid(instance.Process.Pid)
 	if err != nil && err.Error() == noSuchProcessError {
 		return nil
 	}
@@ -91,13 +162,24 @@ func (r *ManageableCommand) Stop() error {
 		return err
 	}
 
-	// Ignore Zombie processes, which can't be killed
-	processesToKill := []int{r.instance.Process.Pid, processGroupID}
-	if runtime.GOOS == "linux" {
-		// pid + 1 because we execute everything through `sh` so we have to kill it as well
-		// this is not necessary on macOS
-		processesToKill = append(processesToKill, r.instance.Process.Pid+1, processGroupID+1)
+	// Give the command the chance to clean up, e.g. for debuggers which have to stop the processes they have launched
+	if r.stopTimeout > 0 {
+		if err := syscall.Kill(-processGroupID, syscall.SIGTERM); err != nil && err.Error() != noSuchProcessError {
+			return err
+		}
+
+		// The whole group has to exit, as `sh` might exit before its children
+		for deadline := time.Now().Add(r.stopTimeout); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+			if err := syscall.Kill(-processGroupID, syscall.Signal(0)); err != nil && err.Error() == noSuchProcessError {
+				return nil
+			}
+		}
 	}
+
+	// Ignore Zombie processes, which can't be killed
+	// We execute everything through `sh` in its own process group, so killing the group kills its children as well;
+	// their pids can't be guessed, as other commands might be started at the same time
+	processesToKill := []int{-processGroupID, instance.Process.Pid}
 	for _, pid := range processesToKill {
 		err = syscall.Kill(pid, syscall.SIGKILL)
 		if err != nil && err.Error() == noSuchProcessError {
@@ -112,9 +194,14 @@ func (r *ManageableCommand) Stop() error {
 }
 
 // TODO: Add test for Zombie processes
-// IsStopped returns true if the command has stopped. WARNING: This always returns false for Zombie processes.
+// IsStopped returns true if the command has stopped or has not been started. WARNING: This always returns false for Zombie processes.
 func (r *ManageableCommand) IsStopped() bool {
-	process, err := os.FindProcess(r.instance.Process.Pid)
+	instance := r.getInstance()
+	if instance == nil || instance.Process == nil {
+		return true
+	}
+
+	process, err := os.FindProcess(instance.Process.Pid)
 	if err != nil {
 		return true
 	}
@@ -127,6 +214,44 @@ func (r *ManageableCommand) IsStopped() bool {
 	return false
 }
 
+// GetExitCode returns the command's exit code once it has been waited for, or -1 if it is still running or has been terminated by a signal
+func (r *ManageableCommand) GetExitCode() int {
+	r.stateLock.Lock()
+	defer r.stateLock.Unlock()
+
+	if r.processState == nil {
+		return -1
+	}
+
+	return r.processState.ExitCode()
+}
+
+// GetExitStatus returns a description of how the command has exited, e.g. `exit status 1` or `signal: killed`
+func (r *ManageableCommand) GetExitStatus() string {
+	r.stateLock.Lock()
+	defer r.stateLock.Unlock()
+
+	if r.instance == nil {
+		return "not started"
+	}
+
+	if r.processState == nil {
+		return "running"
+	}
+
+	return r.processState.String()
+}
+
+// GetStopTimeout returns the time the command is given to exit after SIGTERM when it is stopped
+func (r *ManageableCommand) GetStopTimeout() time.Duration {
+	return r.stopTimeout
+}
+
+// SetStopTimeout sets the time the command is given to exit after SIGTERM when it is stopped before it is killed; if it is 0, it is killed right away
+func (r *ManageableCommand) SetStopTimeout(stopTimeout time.Duration) {
+	r.stopTimeout = stopTimeout
+}
+
 // GetExecLine returns the command's execLine
 func (r *ManageableCommand) GetExecLine() string {
 	return r.execLine
@@ -137,6 +262,16 @@ func (r *ManageableCommand) GetDir() string {
 	return r.dir
 }
 
+// GetEnv returns the env variables which are set for the command in addition to the current environment
+func (r *ManageableCommand) GetEnv() []string {
+	return r.env
+}
+
+// SetEnv sets env variables in the `KEY=value` format for the command in addition to the current environment; it must be called before Start
+func (r *ManageableCommand) SetEnv(env []string) {
+	r.env = env
+}
+
 // GetStdoutChan returns the command's stdout channel
 func (r *ManageableCommand) GetStdoutChan() chan string {
 	return r.stdoutChan
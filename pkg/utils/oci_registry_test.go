@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+var (
+	testOCIBlobUploadRegex = regexp.MustCompile(`^/v2/(.+)/blobs/uploads/(.*)$`)
+	testOCIBlobRegex       = regexp.MustCompile(`^/v2/(.+)/blobs/(sha256:[a-f0-9]+)$`)
+	testOCIManifestRegex   = regexp.MustCompile(`^/v2/(.+)/manifests/(.+)$`)
+)
+
+// testOCIRegistry is a minimal in-memory stand-in for an OCI distribution registry
+type testOCIRegistry struct {
+	username, password string
+	lock               sync.Mutex
+	uploads            map[string][]byte
+	blobs              map[string][]byte
+	manifests          map[string][]byte
+	manifestTypes      map[string]string
+}
+
+func newTestOCIRegistry(username, password string) (*testOCIRegistry, *httptest.Server) {
+	r := &testOCIRegistry{
+		username:      username,
+		password:      password,
+		uploads:       map[string][]byte{},
+		blobs:         map[string][]byte{},
+		manifests:     map[string][]byte{},
+		manifestTypes: map[string]string{},
+	}
+
+	return r, httptest.NewServer(r)
+}
+
+func getTestDigest(content []byte) string {
+	sum := sha256.Sum256(content)
+
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func (r *testOCIRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.username != "" {
+		if username, password, ok := req.BasicAuth(); !ok || username != r.username || password != r.password {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+	}
+
+	body, _ := ioutil.ReadAll(req.Body)
+
+	switch {
+	case req.URL.Path == "/v2/" || req.URL.Path == "/v2":
+		w.WriteHeader(http.StatusOK)
+	case testOCIBlobUploadRegex.MatchString(req.URL.Path):
+		matches := testOCIBlobUploadRegex.FindStringSubmatch(req.URL.Path)
+		id := matches[2]
+
+		switch req.Method {
+		case http.MethodPost:
+			id = strconv.Itoa(len(r.uploads) + 1)
+			r.uploads[id] = body
+
+			if digest := req.URL.Query().Get("digest"); digest != "" {
+				r.blobs[digest] = body
+				w.Header().Set("Docker-Content-Digest", digest)
+				w.WriteHeader(http.StatusCreated)
+
+				return
+			}
+
+			w.Header().Set("Location", "/v2/"+matches[1]+"/blobs/uploads/"+id)
+			w.WriteHeader(http.StatusAccepted)
+		case http.MethodPatch:
+			r.uploads[id] = append(r.uploads[id], body...)
+
+			w.Header().Set("Location", "/v2/"+matches[1]+"/blobs/uploads/"+id)
+			w.Header().Set("Range", "0-"+strconv.Itoa(len(r.uploads[id])-1))
+			w.WriteHeader(http.StatusAccepted)
+		case http.MethodPut:
+			content := append(r.uploads[id], body...)
+			digest := req.URL.Query().Get("digest")
+			if digest != getTestDigest(content) {
+				w.WriteHeader(http.StatusBadRequest)
+
+				return
+			}
+
+			r.blobs[digest] = content
+			delete(r.uploads, id)
+
+			w.Header().Set("Location", "/v2/"+matches[1]+"/blobs/"+digest)
+			w.Header().Set("Docker-Content-Digest", digest)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	case testOCIBlobRegex.MatchString(req.URL.Path):
+		digest := testOCIBlobRegex.FindStringSubmatch(req.URL.Path)[2]
+
+		content, ok := r.blobs[digest]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.WriteHeader(http.StatusOK)
+		if req.Method == http.MethodGet {
+			w.Write(content)
+		}
+	case testOCIManifestRegex.MatchString(req.URL.Path):
+		matches := testOCIManifestRegex.FindStringSubmatch(req.URL.Path)
+		key := matches[1] + ":" + matches[2]
+
+		switch req.Method {
+		case http.MethodPut:
+			digest := getTestDigest(body)
+
+			r.manifests[key] = body
+			r.manifests[matches[1]+":"+digest] = body
+			r.manifestTypes[key] = req.Header.Get("Content-Type")
+			r.manifestTypes[matches[1]+":"+digest] = req.Header.Get("Content-Type")
+
+			w.Header().Set("Docker-Content-Digest", digest)
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodHead, http.MethodGet:
+			content, ok := r.manifests[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+
+				return
+			}
+
+			w.Header().Set("Content-Type", r.manifestTypes[key])
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Header().Set("Docker-Content-Digest", getTestDigest(content))
+			w.WriteHeader(http.StatusOK)
+			if req.Method == http.MethodGet {
+				w.Write(content)
+			}
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (r *testOCIRegistry) hasManifest(key string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	_, ok := r.manifests[key]
+
+	return ok
+}
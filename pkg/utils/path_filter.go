@@ -0,0 +1,215 @@
+package utils
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/format/gitignore"
+)
+
+const (
+	// GitIgnoreFile is the name of Git's ignore files, which may be placed in every directory
+	GitIgnoreFile = ".gitignore"
+	// DockerIgnoreFile is the name of Docker's ignore file, which is only read from the root
+	DockerIgnoreFile = ".dockerignore"
+)
+
+var (
+	// DefaultIgnoreFiles are the ignore files which are honored if none are set
+	DefaultIgnoreFiles = []string{GitIgnoreFile, DockerIgnoreFile}
+)
+
+// PathFilter decides which paths in a watch root are watched.
+// Include and exclude patterns use the .gitignore syntax, e.g. `*.go`, `/cmd/**/*.go` or `node_modules/`.
+type PathFilter struct {
+	root                   string
+	includeRegex           *regexp.Regexp
+	include, exclude       gitignore.Matcher
+	ignore                 gitignore.Matcher
+	hasInclude, hasExclude bool
+}
+
+// NewPathFilter creates a new PathFilter for root.
+// Paths must match includeRegex (if set) and one of the include patterns (if set), must not match one of the exclude patterns
+// and must not be ignored by one of the ignore files in root or its subdirectories.
+func NewPathFilter(root, includeRegex string, include, exclude, ignoreFiles []string) (*PathFilter, error) {
+	filter := &PathFilter{
+		root:       root,
+		include:    gitignore.NewMatcher(parsePatterns(include, nil)),
+		exclude:    gitignore.NewMatcher(parsePatterns(exclude, nil)),
+		hasInclude: len(include) > 0,
+		hasExclude: len(exclude) > 0,
+	}
+
+	if includeRegex != "" {
+		regex, err := regexp.Compile(includeRegex)
+		if err != nil {
+			return nil, err
+		}
+
+		filter.includeRegex = regex
+	}
+
+	var ignorePatterns []gitignore.Pattern
+	if len(ignoreFiles) > 0 {
+		// The Git directory is never part of the sources
+		ignorePatterns = append(ignorePatterns, gitignore.ParsePattern(".git/", nil))
+	}
+
+	for _, ignoreFile := range ignoreFiles {
+		if ignoreFile == DockerIgnoreFile {
+			patterns, err := readIgnoreFile(filepath.Join(root, ignoreFile), nil, true)
+			if err != nil {
+				return nil, err
+			}
+
+			ignorePatterns = append(ignorePatterns, patterns...)
+
+			continue
+		}
+
+		// Ignore files in subdirectories apply to their directory, so directories which are ignored by their parents are not read
+		if err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+
+				return err
+			}
+
+			if !info.IsDir() {
+				return nil
+			}
+
+			domain := filter.split(path)
+			if len(domain) > 0 && gitignore.NewMatcher(ignorePatterns).Match(domain, true) {
+				return filepath.SkipDir
+			}
+
+			patterns, err := readIgnoreFile(filepath.Join(path, ignoreFile), domain, false)
+			if err != nil {
+				return err
+			}
+
+			ignorePatterns = append(ignorePatterns, patterns...)
+
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	filter.ignore = gitignore.NewMatcher(ignorePatterns)
+
+	return filter, nil
+}
+
+func parsePatterns(patterns []string, domain []string) []gitignore.Pattern {
+	var parsed []gitignore.Pattern
+	for _, pattern := range patterns {
+		parsed = append(parsed, gitignore.ParsePattern(pattern, domain))
+	}
+
+	return parsed
+}
+
+// readIgnoreFile reads the patterns of an ignore file; if anchored is set, patterns are relative to the root like in .dockerignore files
+func readIgnoreFile(file string, domain []string, anchored bool) ([]gitignore.Pattern, error) {
+	in, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+	defer in.Close()
+
+	var patterns []string
+
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		pattern := strings.TrimSpace(scanner.Text())
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+
+		if anchored {
+			negated := strings.HasPrefix(pattern, "!")
+			pattern = strings.TrimPrefix(pattern, "!")
+
+			if !strings.HasPrefix(pattern, "/") && !strings.HasPrefix(pattern, "**") {
+				pattern = "/" + pattern
+			}
+
+			if negated {
+				pattern = "!" + pattern
+			}
+		}
+
+		patterns = append(patterns, pattern)
+	}
+
+	return parsePatterns(patterns, domain), scanner.Err()
+}
+
+func isOutside(rel string) bool {
+	return rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (f *PathFilter) split(path string) []string {
+	rel, err := filepath.Rel(f.root, path)
+	if err != nil || rel == "." || isOutside(rel) {
+		return nil
+	}
+
+	return strings.Split(filepath.ToSlash(rel), "/")
+}
+
+// Root returns the watch root of the PathFilter
+func (f *PathFilter) Root() string {
+	return f.root
+}
+
+// Contains returns true if path is in the watch root
+func (f *PathFilter) Contains(path string) bool {
+	rel, err := filepath.Rel(f.root, path)
+
+	return err == nil && !isOutside(rel)
+}
+
+// Skip returns true if the directory dir and everything in it is excluded or ignored
+func (f *PathFilter) Skip(dir string) bool {
+	parts := f.split(dir)
+	if len(parts) == 0 {
+		return false
+	}
+
+	return (f.hasExclude && f.exclude.Match(parts, true)) || f.ignore.Match(parts, true)
+}
+
+// Match returns true if changes to path should be reported
+func (f *PathFilter) Match(path string, isDir bool) bool {
+	if f.includeRegex != nil && !f.includeRegex.MatchString(path) {
+		return false
+	}
+
+	parts := f.split(path)
+	if len(parts) == 0 {
+		return !f.hasInclude
+	}
+
+	if f.hasInclude && !f.include.Match(parts, isDir) {
+		return false
+	}
+
+	if f.hasExclude && f.exclude.Match(parts, isDir) {
+		return false
+	}
+
+	return !f.ignore.Match(parts, isDir)
+}
@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var (
+	testPathFilterDir = filepath.Join(os.TempDir(), "dibs-path-filter-test")
+)
+
+func setupPathFilterTest(t *testing.T) {
+	if err := os.RemoveAll(testPathFilterDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(testPathFilterDir, "pkg", "generated"), 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		".gitignore":          "**/.bin\n# Comment\n*.log\n",
+		".dockerignore":       "charts\n!charts/keep.go\n",
+		"pkg/.gitignore":      "generated/\n",
+		"charts/chart.go":     "",
+		"charts/keep.go":      "",
+		"pkg/charts/chart.go": "",
+	}
+	for name, content := range files {
+		file := filepath.Join(testPathFilterDir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(file, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPathFilter(t *testing.T) {
+	setupPathFilterTest(t)
+
+	f, err := NewPathFilter(testPathFilterDir, "", []string{"*.go", "*.proto"}, []string{"/vendor/", "*_test.go"}, DefaultIgnoreFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path     string
+		isDir    bool
+		expected bool
+	}{
+		{"main.go", false, true},
+		{"api/api.proto", false, true},
+		{"README.md", false, false},
+		{"main_test.go", false, false},
+		{"vendor/dep/dep.go", false, false},
+		{"pkg/vendor/dep.go", false, true},
+		{".bin/binaries/main.go", false, false},
+		{"pkg/.bin/main.go", false, false},
+		{"debug.log", false, false},
+		{"pkg/generated/types.go", false, false},
+		{"generated/types.go", false, true},
+		{"charts/chart.go", false, false},
+		{"charts/keep.go", false, true},
+		{"pkg/charts/chart.go", false, true},
+		{".git/HEAD", false, false},
+	}
+
+	for _, test := range tests {
+		if actual := f.Match(filepath.Join(testPathFilterDir, test.path), test.isDir); actual != test.expected {
+			t.Errorf("Match(%v) returned %v, expected %v", test.path, actual, test.expected)
+		}
+	}
+
+	for dir, expected := range map[string]bool{
+		"":              false,
+		"pkg":           false,
+		"vendor":        true,
+		".bin":          true,
+		".git":          true,
+		"pkg/generated": true,
+	} {
+		if actual := f.Skip(filepath.Join(testPathFilterDir, dir)); actual != expected {
+			t.Errorf("Skip(%v) returned %v, expected %v", dir, actual, expected)
+		}
+	}
+}
+
+func TestRegexPathFilter(t *testing.T) {
+	setupPathFilterTest(t)
+
+	f, err := NewPathFilter(testPathFilterDir, filepath.Join(testPathFilterDir, `(.*)\.go`), nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !f.Match(filepath.Join(testPathFilterDir, ".bin", "main.go"), false) {
+		t.Error("path matching the regex has not been included without ignore files")
+	}
+
+	if f.Match(filepath.Join(testPathFilterDir, "README.md"), false) {
+		t.Error("path not matching the regex has been included")
+	}
+
+	if _, err := NewPathFilter(testPathFilterDir, "(", nil, nil, nil); err == nil {
+		t.Error("invalid regex did not return an error")
+	}
+}
+
+func TestContainsPathFilter(t *testing.T) {
+	f, err := NewPathFilter(testPathFilterDir, "", nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !f.Contains(filepath.Join(testPathFilterDir, "pkg", "main.go")) {
+		t.Error("path in root is not contained")
+	}
+
+	if f.Contains(filepath.Join(testPathFilterDir+"-other", "main.go")) || f.Contains(filepath.Join(testPathFilterDir, "..", "main.go")) {
+		t.Error("path outside of root is contained")
+	}
+}
@@ -1,47 +1,354 @@
 package utils
 
 import (
-	"github.com/radovskyb/watcher"
-	"regexp"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
 	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/radovskyb/watcher"
 )
 
-// PathWatcher watches for changes in a directory
+const (
+	// PathWatcherBackendAuto uses the fsnotify backend and falls back to the polling backend if it is not available
+	PathWatcherBackendAuto = "auto"
+	// PathWatcherBackendFsnotify uses event-driven file system notifications (inotify on Linux)
+	PathWatcherBackendFsnotify = "fsnotify"
+	// PathWatcherBackendPolling polls the whole tree for changes
+	PathWatcherBackendPolling = "polling"
+	// DefaultPathWatcherDebounce is the debounce window used if none is set
+	DefaultPathWatcherDebounce = time.Millisecond * 100
+
+	pollingInterval = time.Millisecond * 100
+)
+
+// PathWatcher watches for changes in the roots of its filters
 type PathWatcher struct {
-	pathWatch, pathInclude string
-	eventChan              chan string
+	filters   []*PathFilter
+	backend   string
+	debounce  time.Duration
+	eventChan chan []string
+	done      chan struct{}
+	stopOnce  sync.Once
 }
 
-// NewPathWatcher creates a new PathWatcher
-func NewPathWatcher(pathWatch, pathInclude string, eventChan chan string) *PathWatcher {
+// NewPathWatcher creates a new PathWatcher.
+// Bursts of events within the debounce window are coalesced into one event with all changed paths;
+// paths which change while the previous event has not been received yet are added to the next one.
+func NewPathWatcher(filters []*PathFilter, backend string, debounce time.Duration, eventChan chan []string) *PathWatcher {
+	if backend == "" {
+		backend = PathWatcherBackendAuto
+	}
+
 	return &PathWatcher{
-		pathWatch:   pathWatch,
-		pathInclude: pathInclude,
-		eventChan:   eventChan,
+		filters:   filters,
+		backend:   backend,
+		debounce:  debounce,
+		eventChan: eventChan,
+		done:      make(chan struct{}),
 	}
 }
 
-// Start starts the PathWatcher
+// Start starts the PathWatcher; it blocks until the PathWatcher is stopped
 func (p *PathWatcher) Start() error {
+	if len(p.filters) == 0 {
+		return errors.New("no paths to watch")
+	}
+
+	var watch *fsnotify.Watcher
+	switch p.backend {
+	case PathWatcherBackendFsnotify:
+		var err error
+		if watch, err = p.newFsnotifyWatcher(); err != nil {
+			return err
+		}
+	case PathWatcherBackendPolling:
+	case PathWatcherBackendAuto:
+		// inotify may be unavailable or its watch limit may be exceeded in large trees, in which case the tree is polled instead
+		watch, _ = p.newFsnotifyWatcher()
+	default:
+		return errors.New("unknown path watcher backend " + p.backend + ", use " + PathWatcherBackendAuto + ", " + PathWatcherBackendFsnotify + " or " + PathWatcherBackendPolling)
+	}
+
+	// The events are only debounced while the backend is running
+	rawEventChan, stopped := make(chan string), make(chan struct{})
+	defer close(stopped)
+
+	go p.debounceEvents(rawEventChan, stopped)
+
+	if watch == nil {
+		return p.startPolling(rawEventChan)
+	}
+
+	return p.startFsnotify(watch, rawEventChan)
+}
+
+// Stop stops the PathWatcher
+func (p *PathWatcher) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.done)
+	})
+}
+
+func (p *PathWatcher) debounceEvents(rawEventChan chan string, stopped chan struct{}) {
+	var (
+		changed   = map[string]bool{}
+		timer     *time.Timer
+		fire      <-chan time.Time
+		eventChan chan []string
+	)
+
+	for {
+		var paths []string
+		if eventChan != nil {
+			for path := range changed {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+		}
+
+		select {
+		case path := <-rawEventChan:
+			changed[path] = true
+
+			if p.debounce <= 0 {
+				eventChan = p.eventChan
+
+				continue
+			}
+
+			// Don't send the paths until no changes have been made for the debounce window
+			eventChan = nil
+
+			if timer == nil {
+				timer = time.NewTimer(p.debounce)
+			} else {
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+
+				timer.Reset(p.debounce)
+			}
+			fire = timer.C
+		case <-fire:
+			fire = nil
+			eventChan = p.eventChan
+		case eventChan <- paths:
+			changed = map[string]bool{}
+			eventChan = nil
+		case <-p.done:
+			return
+		case <-stopped:
+			return
+		}
+	}
+}
+
+func (p *PathWatcher) sendRawEvent(rawEventChan chan string, path string) bool {
+	select {
+	case rawEventChan <- path:
+		return true
+	case <-p.done:
+		return false
+	}
+}
+
+// getFilter returns the filter with the most specific root which contains path
+func (p *PathWatcher) getFilter(path string) *PathFilter {
+	var filter *PathFilter
+	for _, candidate := range p.filters {
+		if candidate.Contains(path) && (filter == nil || len(candidate.Root()) > len(filter.Root())) {
+			filter = candidate
+		}
+	}
+
+	return filter
+}
+
+func (p *PathWatcher) match(path string, isDir bool) bool {
+	filter := p.getFilter(path)
+
+	return filter != nil && filter.Match(path, isDir)
+}
+
+func (p *PathWatcher) skip(dir string) bool {
+	filter := p.getFilter(dir)
+
+	return filter == nil || filter.Skip(dir)
+}
+
+func (p *PathWatcher) newFsnotifyWatcher() (*fsnotify.Watcher, error) {
+	watch, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, filter := range p.filters {
+		if err := p.addRecursive(watch, filter.Root(), nil); err != nil {
+			watch.Close()
+
+			return nil, err
+		}
+	}
+
+	return watch, nil
+}
+
+// addRecursive adds root and all directories below it which are not skipped to watch and calls onFile for every file in them
+func (p *PathWatcher) addRecursive(watch *fsnotify.Watcher, root string, onFile func(path string)) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Directories might be removed while they are being walked
+			if os.IsNotExist(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		if info.IsDir() {
+			if p.skip(path) {
+				return filepath.SkipDir
+			}
+
+			return watch.Add(path)
+		}
+
+		if onFile != nil {
+			onFile(path)
+		}
+
+		return nil
+	})
+}
+
+func (p *PathWatcher) startFsnotify(watch *fsnotify.Watcher, rawEventChan chan string) error {
+	defer watch.Close()
+
+	for {
+		select {
+		case event, ok := <-watch.Events:
+			if !ok {
+				return nil
+			}
+
+			// Permission and timestamp changes don't change the content
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+
+			if event.Op&fsnotify.Create == fsnotify.Create {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					// Files might have been created in the directory before it has been added, so they are reported too
+					var files []string
+					if err := p.addRecursive(watch, event.Name, func(path string) {
+						files = append(files, path)
+					}); err != nil {
+						return err
+					}
+
+					for _, file := range files {
+						if p.match(file, false) && !p.sendRawEvent(rawEventChan, file) {
+							return nil
+						}
+					}
+				}
+			}
+
+			if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+				// Removed directories are no longer watched, so this only cleans up the watch list
+				_ = watch.Remove(event.Name)
+			}
+
+			isDir := false
+			if info, err := os.Stat(event.Name); err == nil {
+				isDir = info.IsDir()
+			}
+
+			if p.match(event.Name, isDir) && !p.sendRawEvent(rawEventChan, event.Name) {
+				return nil
+			}
+		case err, ok := <-watch.Errors:
+			if !ok {
+				return nil
+			}
+
+			// Events have been dropped, so something in the tree has changed
+			if err == fsnotify.ErrEventOverflow {
+				if !p.sendRawEvent(rawEventChan, p.filters[0].Root()) {
+					return nil
+				}
+
+				continue
+			}
+
+			return err
+		case <-p.done:
+			return nil
+		}
+	}
+}
+
+func (p *PathWatcher) startPolling(rawEventChan chan string) error {
 	watch := watcher.New()
 
-	pathIncludeRegex := regexp.MustCompile(p.pathInclude)
-	watch.AddFilterHook(watcher.RegexFilterHook(pathIncludeRegex, true))
+	watch.AddFilterHook(func(info os.FileInfo, fullPath string) error {
+		if !p.match(fullPath, info.IsDir()) {
+			return watcher.ErrSkip
+		}
+
+		return nil
+	})
 
-	if err := watch.AddRecursive(p.pathWatch); err != nil {
-		return err
+	for _, filter := range p.filters {
+		// Skipped directories have to be ignored before they are added, as the filter hook can't prevent them from being walked
+		if err := filepath.Walk(filter.Root(), func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if info.IsDir() && p.skip(path) {
+				if err := watch.Ignore(path); err != nil {
+					return err
+				}
+
+				return filepath.SkipDir
+			}
+
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		if err := watch.AddRecursive(filter.Root()); err != nil {
+			return err
+		}
 	}
 
 	go func() {
 		for {
 			select {
 			case event := <-watch.Event:
-				p.eventChan <- event.Path
+				if !p.sendRawEvent(rawEventChan, event.Path) {
+					return
+				}
+			case <-watch.Error:
+				// Errors such as deleted files are not fatal while polling
 			case <-watch.Closed:
+				return
+			case <-p.done:
+				watch.Close()
+
 				return
 			}
 		}
 	}()
 
-	return watch.Start(time.Millisecond * 100)
+	return watch.Start(pollingInterval)
 }
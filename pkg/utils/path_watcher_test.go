@@ -1,26 +1,43 @@
 package utils
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
+)
+
+var (
+	testPathWatcherDir = filepath.Join(os.TempDir(), "dibs-path-watcher-test")
 )
 
 func TestCreatePathWatcher(t *testing.T) {
-	pathWatch := "."
-	pathInclude := ".*"
-	eventChan := make(chan string)
+	filter, err := NewPathFilter(".", ".*", nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filters := []*PathFilter{filter}
+	eventChan := make(chan []string)
 
-	w := NewPathWatcher(pathWatch, pathInclude, eventChan)
+	w := NewPathWatcher(filters, "", DefaultPathWatcherDebounce, eventChan)
 
 	if w == nil {
 		t.Error("New path watcher is nil")
 	}
 
-	if w.pathWatch != pathWatch {
-		t.Error("pathWatch not set correctly")
+	if len(w.filters) != 1 || w.filters[0] != filter {
+		t.Error("filters not set correctly")
+	}
+
+	if w.backend != PathWatcherBackendAuto {
+		t.Error("backend not set correctly")
 	}
 
-	if w.pathInclude != pathInclude {
-		t.Error("pathInclude not set correctly")
+	if w.debounce != DefaultPathWatcherDebounce {
+		t.Error("debounce not set correctly")
 	}
 
 	if w.eventChan != eventChan {
@@ -28,17 +45,265 @@ func TestCreatePathWatcher(t *testing.T) {
 	}
 }
 
-func TestStartPathWatcher(t *testing.T) {
-	pathWatch := "."
-	pathInclude := ".*"
-	eventChan := make(chan string)
+func setupPathWatcherTest(t *testing.T) {
+	if err := os.RemoveAll(testPathWatcherDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(testPathWatcherDir, 0777); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func startTestPathWatcher(t *testing.T, backend string, debounce time.Duration, filters ...*PathFilter) (*PathWatcher, chan []string) {
+	if len(filters) == 0 {
+		setupPathWatcherTest(t)
+
+		filter, err := NewPathFilter(testPathWatcherDir, `.*\.go$`, nil, nil, DefaultIgnoreFiles)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		filters = append(filters, filter)
+	}
+
+	eventChan := make(chan []string)
 
-	w := NewPathWatcher(pathWatch, pathInclude, eventChan)
+	w := NewPathWatcher(filters, backend, debounce, eventChan)
 
-	// FIXME: Add tests that test if the watcher actually gets a file change, creation and deletion event etc.
 	go func() {
 		if err := w.Start(); err != nil {
 			t.Error(err)
 		}
 	}()
+
+	// Give the backend time to add the initial watches or to take the first snapshot
+	time.Sleep(time.Millisecond * 300)
+
+	return w, eventChan
+}
+
+func waitForPathWatcherEvent(t *testing.T, eventChan chan []string) []string {
+	select {
+	case paths := <-eventChan:
+		return paths
+	case <-time.After(time.Second * 5):
+		t.Fatal("path watcher did not send an event")
+
+		return nil
+	}
+}
+
+func expectPathWatcherEvent(t *testing.T, eventChan chan []string, expected ...string) {
+	paths := waitForPathWatcherEvent(t, eventChan)
+
+	if strings.Join(paths, ",") != strings.Join(expected, ",") {
+		t.Errorf("event has paths %v, expected %v", paths, expected)
+	}
+}
+
+func testPathWatcherEvents(t *testing.T, backend string) {
+	w, eventChan := startTestPathWatcher(t, backend, time.Millisecond*50)
+	defer w.Stop()
+
+	file := filepath.Join(testPathWatcherDir, "main.go")
+	if err := ioutil.WriteFile(file, []byte("package main"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	expectPathWatcherEvent(t, eventChan, file)
+
+	// Files in new directories are watched too
+	if err := os.MkdirAll(filepath.Join(testPathWatcherDir, "pkg", "utils"), 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	nestedFile := filepath.Join(testPathWatcherDir, "pkg", "utils", "utils.go")
+	if err := ioutil.WriteFile(nestedFile, []byte("package utils"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	expectPathWatcherEvent(t, eventChan, nestedFile)
+
+	// Files which are not included are ignored
+	if err := ioutil.WriteFile(filepath.Join(testPathWatcherDir, "README.md"), []byte("# Test"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+
+	expectPathWatcherEvent(t, eventChan, file)
+}
+
+func TestFsnotifyPathWatcher(t *testing.T) {
+	testPathWatcherEvents(t, PathWatcherBackendFsnotify)
+}
+
+func TestPollingPathWatcher(t *testing.T) {
+	testPathWatcherEvents(t, PathWatcherBackendPolling)
+}
+
+func TestDebouncePathWatcher(t *testing.T) {
+	w, eventChan := startTestPathWatcher(t, PathWatcherBackendFsnotify, time.Millisecond*300)
+	defer w.Stop()
+
+	for i := 0; i < 10; i++ {
+		if err := ioutil.WriteFile(filepath.Join(testPathWatcherDir, "main.go"), []byte("package main"), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	waitForPathWatcherEvent(t, eventChan)
+
+	select {
+	case paths := <-eventChan:
+		t.Error("burst of saves has not been coalesced into one event", paths)
+	case <-time.After(time.Millisecond * 600):
+	}
+}
+
+func TestFsnotifyChmodPathWatcher(t *testing.T) {
+	setupPathWatcherTest(t)
+
+	file := filepath.Join(testPathWatcherDir, "main.go")
+	if err := ioutil.WriteFile(file, []byte("package main"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	w, eventChan := startTestPathWatcher(t, PathWatcherBackendFsnotify, time.Millisecond*50, func() *PathFilter {
+		filter, err := NewPathFilter(testPathWatcherDir, `.*\.go$`, nil, nil, DefaultIgnoreFiles)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return filter
+	}())
+	defer w.Stop()
+
+	// Attribute changes, e.g. by `touch` or `chmod`, are ignored
+	if err := os.Chmod(file, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chtimes(file, time.Now(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case paths := <-eventChan:
+		t.Error("attribute changes have been reported", paths)
+	case <-time.After(time.Millisecond * 300):
+	}
+
+	if err := ioutil.WriteFile(file, []byte("package main\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	expectPathWatcherEvent(t, eventChan, file)
+}
+
+func TestInvalidBackendPathWatcher(t *testing.T) {
+	filter, err := NewPathFilter(".", ".*", nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewPathWatcher([]*PathFilter{filter}, "invalid", DefaultPathWatcherDebounce, make(chan []string))
+
+	goroutines := runtime.NumGoroutine()
+
+	if err := w.Start(); err == nil {
+		t.Error("invalid backend did not return an error")
+	}
+
+	// Nothing may be left running if the watcher could not be started
+	if leaked := runtime.NumGoroutine() - goroutines; leaked > 0 {
+		t.Error(leaked, "goroutines are still running after the watcher failed to start")
+	}
+}
+
+func testPathWatcherIgnores(t *testing.T, backend string) {
+	setupPathWatcherTest(t)
+
+	roots := []string{filepath.Join(testPathWatcherDir, "app"), filepath.Join(testPathWatcherDir, "lib")}
+	for _, root := range roots {
+		if err := os.MkdirAll(filepath.Join(root, ".bin", "binaries"), 0777); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.MkdirAll(filepath.Join(root, "node_modules", "dep"), 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(roots[0], ".gitignore"), []byte("**/.bin\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	var filters []*PathFilter
+	for _, root := range roots {
+		filter, err := NewPathFilter(root, "", []string{"*.go", "*.proto"}, []string{"node_modules/"}, DefaultIgnoreFiles)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		filters = append(filters, filter)
+	}
+
+	w, eventChan := startTestPathWatcher(t, backend, time.Millisecond*50, filters...)
+	defer w.Stop()
+
+	for _, ignored := range []string{
+		filepath.Join(roots[0], ".bin", "binaries", "main.go"),
+		filepath.Join(roots[0], "node_modules", "dep", "index.go"),
+		filepath.Join(roots[0], "README.md"),
+	} {
+		if err := ioutil.WriteFile(ignored, []byte("ignored"), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	file := filepath.Join(roots[1], "api.proto")
+	if err := ioutil.WriteFile(file, []byte("syntax = \"proto3\";"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	expectPathWatcherEvent(t, eventChan, file)
+}
+
+func TestFsnotifyIgnoresPathWatcher(t *testing.T) {
+	testPathWatcherIgnores(t, PathWatcherBackendFsnotify)
+}
+
+func TestPollingIgnoresPathWatcher(t *testing.T) {
+	testPathWatcherIgnores(t, PathWatcherBackendPolling)
+}
+
+func TestCoalescePathWatcher(t *testing.T) {
+	w, eventChan := startTestPathWatcher(t, PathWatcherBackendFsnotify, time.Millisecond*50)
+	defer w.Stop()
+
+	files := []string{filepath.Join(testPathWatcherDir, "a.go"), filepath.Join(testPathWatcherDir, "b.go")}
+	for _, file := range files {
+		if err := ioutil.WriteFile(file, []byte("package main"), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expectPathWatcherEvent(t, eventChan, files...)
+
+	// Paths which change while the event is not being received are collected for the next one
+	for _, file := range files {
+		if err := ioutil.WriteFile(file, []byte("package main"), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		time.Sleep(time.Millisecond * 200)
+	}
+
+	expectPathWatcherEvent(t, eventChan, files...)
 }
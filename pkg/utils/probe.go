@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultProbeInterval is the time between two checks of a probe if none is set
+	DefaultProbeInterval = time.Second
+	// DefaultProbeTimeout is the time after which a check of a probe fails if none is set
+	DefaultProbeTimeout = time.Second
+	// DefaultReadinessFailureThreshold is the number of failed checks after which a service is reported as not ready if none is set
+	DefaultReadinessFailureThreshold = 30
+	// DefaultLivenessFailureThreshold is the number of consecutive failed checks after which a service is restarted if none is set
+	DefaultLivenessFailureThreshold = 3
+)
+
+// Probe checks whether a service is ready or alive; exactly one of TCP, HTTP, Log and Exec must be set
+type Probe struct {
+	// TCP is an address which must accept connections, e.g. `localhost:8080`
+	TCP string
+	// HTTP is a URL which must respond to GET requests with a 2xx status code
+	HTTP string
+	// Log is a regular expression which must match a line which the service has logged since the previous check
+	Log string
+	// Exec is a command which must exit with status 0
+	Exec string
+
+	Interval         time.Duration
+	Timeout          time.Duration
+	FailureThreshold int
+}
+
+// probeRunner checks a Probe and counts the log lines which match it
+type probeRunner struct {
+	probe                         Probe
+	logRegex                      *regexp.Regexp
+	logMatches, checkedLogMatches uint64
+}
+
+func newProbeRunner(probe *Probe, defaultFailureThreshold int) (*probeRunner, error) {
+	if probe == nil {
+		return nil, nil
+	}
+
+	checks := 0
+	for _, check := range []string{probe.TCP, probe.HTTP, probe.Log, probe.Exec} {
+		if check != "" {
+			checks++
+		}
+	}
+	if checks != 1 {
+		return nil, errors.New("probes must have exactly one of tcp, http, log and exec, but this one has " + strconv.Itoa(checks))
+	}
+
+	runner := &probeRunner{
+		probe: *probe,
+	}
+
+	if runner.probe.Interval <= 0 {
+		runner.probe.Interval = DefaultProbeInterval
+	}
+	if runner.probe.Timeout <= 0 {
+		runner.probe.Timeout = DefaultProbeTimeout
+	}
+	if runner.probe.FailureThreshold <= 0 {
+		runner.probe.FailureThreshold = defaultFailureThreshold
+	}
+
+	if probe.Log != "" {
+		regex, err := regexp.Compile(probe.Log)
+		if err != nil {
+			return nil, err
+		}
+
+		runner.logRegex = regex
+	}
+
+	return runner, nil
+}
+
+// observe counts line if it matches the probe's log regex
+func (p *probeRunner) observe(line string) {
+	if p.logRegex != nil && p.logRegex.MatchString(line) {
+		atomic.AddUint64(&p.logMatches, 1)
+	}
+}
+
+// reset ignores all log lines which have been observed before
+func (p *probeRunner) reset() {
+	atomic.StoreUint64(&p.checkedLogMatches, atomic.LoadUint64(&p.logMatches))
+}
+
+// check checks the probe once; commands are run in dir
+func (p *probeRunner) check(dir string) error {
+	switch {
+	case p.probe.TCP != "":
+		conn, err := net.DialTimeout("tcp", p.probe.TCP, p.probe.Timeout)
+		if err != nil {
+			return err
+		}
+
+		return conn.Close()
+	case p.probe.HTTP != "":
+		client := &http.Client{Timeout: p.probe.Timeout}
+
+		res, err := client.Get(p.probe.HTTP)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			return errors.New("GET " + p.probe.HTTP + " returned status " + res.Status)
+		}
+
+		return nil
+	case p.probe.Log != "":
+		logMatches := atomic.LoadUint64(&p.logMatches)
+		if logMatches == atomic.SwapUint64(&p.checkedLogMatches, logMatches) {
+			return errors.New("no log line matched " + p.probe.Log)
+		}
+
+		return nil
+	default:
+		ctx, cancel := context.WithTimeout(context.Background(), p.probe.Timeout)
+		defer cancel()
+
+		command := exec.CommandContext(ctx, "sh", "-c", p.probe.Exec)
+		command.Dir = dir
+		// Children of the shell might keep its output open after it has been killed
+		command.WaitDelay = p.probe.Timeout
+
+		if output, err := command.CombinedOutput(); err != nil {
+			if ctx.Err() != nil {
+				return errors.New(p.probe.Exec + " timed out after " + p.probe.Timeout.String())
+			}
+
+			return errors.New(p.probe.Exec + " failed: " + err.Error() + ": " + strings.TrimSpace(string(output)))
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTCPProbe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := newProbeRunner(&Probe{TCP: listener.Addr().String()}, DefaultLivenessFailureThreshold)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.check(testDir); err != nil {
+		t.Error("probe failed for open port", err)
+	}
+
+	if err := listener.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.check(testDir); err == nil {
+		t.Error("probe succeeded for closed port")
+	}
+}
+
+func TestHTTPProbe(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	p, err := newProbeRunner(&Probe{HTTP: server.URL}, DefaultLivenessFailureThreshold)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.check(testDir); err != nil {
+		t.Error("probe failed for 2xx status", err)
+	}
+
+	status = http.StatusServiceUnavailable
+
+	if err := p.check(testDir); err == nil {
+		t.Error("probe succeeded for 5xx status")
+	}
+}
+
+func TestLogProbe(t *testing.T) {
+	p, err := newProbeRunner(&Probe{Log: "listening on :[0-9]+"}, DefaultReadinessFailureThreshold)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.observe("listening on :1234")
+	p.reset()
+
+	if err := p.check(testDir); err == nil {
+		t.Error("probe succeeded for line which has been logged before reset")
+	}
+
+	p.observe("starting")
+	p.observe("listening on :8080")
+
+	if err := p.check(testDir); err != nil {
+		t.Error("probe failed for matching line", err)
+	}
+
+	if err := p.check(testDir); err == nil {
+		t.Error("probe succeeded without new matching line")
+	}
+}
+
+func TestExecProbe(t *testing.T) {
+	for _, test := range []struct {
+		command string
+		ok      bool
+	}{
+		{"true", true},
+		{"exit 1", false},
+		{"sleep 10", false},
+	} {
+		p, err := newProbeRunner(&Probe{Exec: test.command, Timeout: time.Millisecond * 100}, DefaultLivenessFailureThreshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := p.check(testDir); (err == nil) != test.ok {
+			t.Errorf("probe for %q returned %v", test.command, err)
+		}
+	}
+}
+
+func TestInvalidProbe(t *testing.T) {
+	for _, probe := range []*Probe{
+		{},
+		{TCP: "localhost:8080", HTTP: "http://localhost:8080"},
+		{Log: "("},
+	} {
+		if _, err := newProbeRunner(probe, DefaultLivenessFailureThreshold); err == nil {
+			t.Errorf("invalid probe %+v did not return an error", probe)
+		}
+	}
+
+	if p, err := newProbeRunner(nil, DefaultLivenessFailureThreshold); p != nil || err != nil {
+		t.Error("missing probe returned a probe runner or an error")
+	}
+}
@@ -0,0 +1,234 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/src-d/go-git.v4"
+)
+
+const (
+	// ProvenanceExtension is the extension of provenance files
+	ProvenanceExtension = ".intoto.json"
+	// ProvenanceStatementType is the in-toto statement type of provenance files
+	ProvenanceStatementType = "https://in-toto.io/Statement/v0.1"
+	// ProvenancePredicateType is the SLSA predicate type of provenance files
+	ProvenancePredicateType = "https://slsa.dev/provenance/v0.2"
+	// ProvenanceBuilderID identifies dibs as the builder in provenance files
+	ProvenanceBuilderID = "https://github.com/pojntfx/dibs"
+)
+
+// ProvenanceDigest maps a digest algorithm to a hex-encoded digest
+type ProvenanceDigest map[string]string
+
+// ProvenanceSubject is an artifact described by a provenance file
+type ProvenanceSubject struct {
+	Name   string           `json:"name"`
+	Digest ProvenanceDigest `json:"digest"`
+}
+
+// ProvenanceMaterial is an input to the build described by a provenance file
+type ProvenanceMaterial struct {
+	URI    string           `json:"uri"`
+	Digest ProvenanceDigest `json:"digest"`
+}
+
+// ProvenanceCommand is a command that has been run during the build
+type ProvenanceCommand struct {
+	Stage   string `json:"stage"`
+	Command string `json:"command"`
+}
+
+// Provenance is an in-toto statement with a SLSA provenance predicate
+type Provenance struct {
+	Type          string              `json:"_type"`
+	PredicateType string              `json:"predicateType"`
+	Subject       []ProvenanceSubject `json:"subject"`
+	Predicate     struct {
+		Builder struct {
+			ID string `json:"id"`
+		} `json:"builder"`
+		BuildType  string `json:"buildType"`
+		Invocation struct {
+			ConfigSource struct {
+				URI        string           `json:"uri"`
+				Digest     ProvenanceDigest `json:"digest"`
+				EntryPoint string           `json:"entryPoint"`
+			} `json:"configSource"`
+			Parameters map[string]string `json:"parameters"`
+		} `json:"invocation"`
+		BuildConfig struct {
+			Commands []ProvenanceCommand `json:"commands"`
+		} `json:"buildConfig"`
+		Materials []ProvenanceMaterial `json:"materials"`
+	} `json:"predicate"`
+}
+
+// ProvenanceManager manages provenance attestations
+type ProvenanceManager struct {
+	dir                    string
+	stdoutChan, stderrChan chan string
+}
+
+// NewProvenanceManager creates a new ProvenanceManager
+func NewProvenanceManager(dir string, stdoutChan, stderrChan chan string) *ProvenanceManager {
+	return &ProvenanceManager{
+		dir:        dir,
+		stdoutChan: stdoutChan,
+		stderrChan: stderrChan,
+	}
+}
+
+// GetInputFiles returns all files in the roots of the filters which they match
+func GetInputFiles(filters []*PathFilter) ([]string, error) {
+	var files []string
+	for _, filter := range filters {
+		if err := filepath.Walk(filter.Root(), func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if info.IsDir() {
+				if info.Name() == ".git" || info.Name() == ".bin" || filter.Skip(path) {
+					return filepath.SkipDir
+				}
+
+				return nil
+			}
+
+			if filter.Match(path, false) {
+				files = append(files, path)
+			}
+
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+func getGitSource(gitRepoRoot string) (string, string, error) {
+	repository, err := git.PlainOpen(gitRepoRoot)
+	if err != nil {
+		return "", "", err
+	}
+
+	head, err := repository.Head()
+	if err != nil {
+		return "", "", err
+	}
+
+	uri := ""
+	if remote, err := repository.Remote("origin"); err == nil && len(remote.Config().URLs) > 0 {
+		uri = remote.Config().URLs[0]
+	}
+
+	return uri, head.Hash().String(), nil
+}
+
+// Generate creates the provenance of the subjects from the config file, Git commit, commands and inputs of a build
+func (p *ProvenanceManager) Generate(subjects []string, configFile, gitRepoRoot, target, platform string, commands []ProvenanceCommand, inputs []string) (*Provenance, error) {
+	provenance := &Provenance{
+		Type:          ProvenanceStatementType,
+		PredicateType: ProvenancePredicateType,
+	}
+
+	for _, subject := range subjects {
+		sum, err := getSHA256Sum(subject)
+		if err != nil {
+			return nil, err
+		}
+
+		provenance.Subject = append(provenance.Subject, ProvenanceSubject{
+			Name:   filepath.Base(subject),
+			Digest: ProvenanceDigest{"sha256": sum},
+		})
+	}
+
+	uri, commit, err := getGitSource(gitRepoRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	provenance.Predicate.Builder.ID = ProvenanceBuilderID
+	provenance.Predicate.BuildType = ProvenanceBuilderID + "/dibs.yaml"
+	provenance.Predicate.Invocation.ConfigSource.URI = uri
+	provenance.Predicate.Invocation.ConfigSource.Digest = ProvenanceDigest{"sha1": commit}
+	provenance.Predicate.Invocation.ConfigSource.EntryPoint = filepath.Base(configFile)
+	provenance.Predicate.Invocation.Parameters = map[string]string{
+		"target":   target,
+		"platform": platform,
+	}
+	provenance.Predicate.BuildConfig.Commands = commands
+
+	for _, input := range append([]string{configFile}, inputs...) {
+		sum, err := getSHA256Sum(input)
+		if err != nil {
+			return nil, err
+		}
+
+		uri, err := filepath.Rel(p.dir, input)
+		if err != nil {
+			return nil, err
+		}
+
+		provenance.Predicate.Materials = append(provenance.Predicate.Materials, ProvenanceMaterial{
+			URI:    uri,
+			Digest: ProvenanceDigest{"sha256": sum},
+		})
+	}
+
+	return provenance, nil
+}
+
+// Write writes the provenance to file
+func (p *ProvenanceManager) Write(provenance *Provenance, file string) error {
+	content, err := json.MarshalIndent(provenance, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, append(content, '\n'), 0666)
+}
+
+// Verify checks that all subjects of a provenance file exist next to it and match their digests
+func (p *ProvenanceManager) Verify(file string) error {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	provenance := Provenance{}
+	if err := json.Unmarshal(content, &provenance); err != nil {
+		return err
+	}
+
+	if provenance.Type != ProvenanceStatementType || provenance.PredicateType != ProvenancePredicateType {
+		return errors.New("unsupported provenance type in " + file)
+	}
+
+	if len(provenance.Subject) == 0 {
+		return errors.New("no subjects in " + file)
+	}
+
+	for _, subject := range provenance.Subject {
+		sum, err := getSHA256Sum(filepath.Join(filepath.Dir(file), subject.Name))
+		if err != nil {
+			return err
+		}
+
+		if sum != subject.Digest["sha256"] {
+			return errors.New("digest mismatch for " + subject.Name + " in " + file)
+		}
+	}
+
+	return nil
+}
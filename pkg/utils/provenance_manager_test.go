@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+var (
+	testProvenanceRepo   = filepath.Join(os.TempDir(), "test-provenance-repo")
+	testProvenanceConfig = filepath.Join(testProvenanceRepo, "dibs.yaml")
+	testProvenanceSource = filepath.Join(testProvenanceRepo, "main.go")
+)
+
+func setupProvenanceTest(t *testing.T) string {
+	setupArchiveTest(t)
+
+	if err := os.RemoveAll(testProvenanceRepo); err != nil {
+		t.Fatal(err)
+	}
+
+	repository, err := git.PlainInit(testProvenanceRepo, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for file, content := range map[string]string{
+		testProvenanceConfig: "targets: []",
+		testProvenanceSource: "package main",
+	} {
+		if err := ioutil.WriteFile(file, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wt, err := repository.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := wt.Add("."); err != nil {
+		t.Fatal(err)
+	}
+
+	commit, err := wt.Commit("chore: Initial commit", &git.CommitOptions{
+		Author: &object.Signature{Name: "dibs", Email: "dibs@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return commit.String()
+}
+
+func TestCreateProvenanceManager(t *testing.T) {
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+
+	p := NewProvenanceManager(testContext, stdoutChan, stderrChan)
+
+	if p == nil {
+		t.Error("New provenance manager is nil")
+	}
+
+	if p.dir != testContext {
+		t.Error("dir not set correctly")
+	}
+
+	if p.stdoutChan != stdoutChan {
+		t.Error("stdoutChan not set correctly")
+	}
+
+	if p.stderrChan != stderrChan {
+		t.Error("stderrChan not correctly")
+	}
+}
+
+func TestGetInputFiles(t *testing.T) {
+	setupProvenanceTest(t)
+
+	filter, err := NewPathFilter(testProvenanceRepo, `(.*)\.go`, nil, nil, DefaultIgnoreFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inputs, err := GetInputFiles([]*PathFilter{filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(inputs) != 1 || inputs[0] != testProvenanceSource {
+		t.Error("inputs not found correctly", inputs)
+	}
+}
+
+func TestGenerateAndVerifyProvenanceManager(t *testing.T) {
+	commit := setupProvenanceTest(t)
+
+	p := NewProvenanceManager(testProvenanceRepo, make(chan string), make(chan string))
+
+	provenance, err := p.Generate(
+		[]string{testArchiveAsset},
+		testProvenanceConfig,
+		testProvenanceRepo,
+		"linux",
+		"linux/amd64",
+		[]ProvenanceCommand{{Stage: "build", Command: "go build"}},
+		[]string{testProvenanceSource},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if provenance.Predicate.Invocation.ConfigSource.Digest["sha1"] != commit {
+		t.Error("commit not recorded correctly")
+	}
+
+	if len(provenance.Predicate.Materials) != 2 || provenance.Predicate.Materials[1].URI != "main.go" {
+		t.Error("materials not recorded correctly", provenance.Predicate.Materials)
+	}
+
+	provenanceFile := testArchiveAsset + ProvenanceExtension
+	if err := p.Write(provenance, provenanceFile); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Verify(provenanceFile); err != nil {
+		t.Error(err)
+	}
+
+	if err := ioutil.WriteFile(testArchiveAsset, []byte("tampered binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Verify(provenanceFile); err == nil {
+		t.Error("tampered subject passed verification")
+	}
+}
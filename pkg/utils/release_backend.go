@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const (
+	// GitHubAPIURL is the URL of the GitHub API
+	GitHubAPIURL = "https://api.github.com"
+	// GitHubUploadURL is the URL of the GitHub API for uploads
+	GitHubUploadURL = "https://uploads.github.com"
+)
+
+// ReleaseBackend uploads files to releases
+type ReleaseBackend interface {
+	// Upload uploads a file to the release for tag, creating the release if it does not exist yet, and returns the file's download URL
+	Upload(tag, file string) (string, error)
+}
+
+// GitHubReleaseBackend uploads files to GitHub releases
+type GitHubReleaseBackend struct {
+	apiURL, uploadURL, owner, repository, token string
+	client                                      *http.Client
+}
+
+// NewGitHubReleaseBackend creates a new GitHubReleaseBackend
+func NewGitHubReleaseBackend(apiURL, uploadURL, owner, repository, token string) *GitHubReleaseBackend {
+	return &GitHubReleaseBackend{
+		apiURL:     apiURL,
+		uploadURL:  uploadURL,
+		owner:      owner,
+		repository: repository,
+		token:      token,
+		client:     http.DefaultClient,
+	}
+}
+
+type gitHubRelease struct {
+	ID     int64 `json:"id"`
+	Assets []struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	} `json:"assets"`
+}
+
+type gitHubAsset struct {
+	BrowserDownloadURL string `json:"browser_download_url"`
+}
+
+func (g *GitHubReleaseBackend) do(method, endpoint, contentType string, body io.Reader, contentLength int64, out interface{}) (int, error) {
+	request, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return 0, err
+	}
+
+	request.Header.Set("Accept", "application/vnd.github.v3+json")
+	request.Header.Set("Authorization", "token "+g.token)
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	if contentLength > 0 {
+		request.ContentLength = contentLength
+	}
+
+	response, err := g.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 400 {
+		message, _ := ioutil.ReadAll(response.Body)
+
+		return response.StatusCode, errors.New(method + " " + endpoint + " failed with status " + response.Status + ": " + string(message))
+	}
+
+	if out != nil {
+		return response.StatusCode, json.NewDecoder(response.Body).Decode(out)
+	}
+
+	return response.StatusCode, nil
+}
+
+func (g *GitHubReleaseBackend) getOrCreateRelease(tag string) (*gitHubRelease, error) {
+	releasesURL := g.apiURL + "/repos/" + g.owner + "/" + g.repository + "/releases"
+
+	release := &gitHubRelease{}
+	status, err := g.do(http.MethodGet, releasesURL+"/tags/"+url.PathEscape(tag), "", nil, 0, release)
+	if err == nil {
+		return release, nil
+	}
+
+	if status != http.StatusNotFound {
+		return nil, err
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"tag_name": tag,
+		"name":     tag,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := g.do(http.MethodPost, releasesURL, "application/json", bytes.NewReader(body), int64(len(body)), release); err != nil {
+		return nil, err
+	}
+
+	return release, nil
+}
+
+// Upload uploads a file to the GitHub release for tag, replacing existing assets with the same name
+func (g *GitHubReleaseBackend) Upload(tag, file string) (string, error) {
+	release, err := g.getOrCreateRelease(tag)
+	if err != nil {
+		return "", err
+	}
+
+	name := filepath.Base(file)
+	for _, asset := range release.Assets {
+		if asset.Name == name {
+			if _, err := g.do(http.MethodDelete, g.apiURL+"/repos/"+g.owner+"/"+g.repository+"/releases/assets/"+strconv.FormatInt(asset.ID, 10), "", nil, 0, nil); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	in, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	asset := &gitHubAsset{}
+	if _, err := g.do(
+		http.MethodPost,
+		g.uploadURL+"/repos/"+g.owner+"/"+g.repository+"/releases/"+strconv.FormatInt(release.ID, 10)+"/assets?name="+url.QueryEscape(name),
+		"application/octet-stream",
+		in,
+		info.Size(),
+		asset,
+	); err != nil {
+		return "", err
+	}
+
+	return asset.BrowserDownloadURL, nil
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestUploadGitHubReleaseBackend(t *testing.T) {
+	setupArchiveTest(t)
+
+	uploaded := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token test-token" {
+			t.Error("token not sent", r.Header.Get("Authorization"))
+		}
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/pojntfx/charts/releases/tags/test-app-0.0.1":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/pojntfx/charts/releases":
+			release := map[string]string{}
+			if err := json.NewDecoder(r.Body).Decode(&release); err != nil {
+				t.Error(err)
+			}
+
+			if release["tag_name"] != "test-app-0.0.1" {
+				t.Error("release not created for tag", release)
+			}
+
+			w.Write([]byte(`{"id":1,"assets":[]}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/pojntfx/charts/releases/1/assets":
+			content, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				t.Error(err)
+			}
+			uploaded = r.URL.Query().Get("name") + ":" + string(content)
+
+			w.Write([]byte(`{"browser_download_url":"https://example.com/test-app-linux-amd64"}`))
+		default:
+			t.Error("unexpected request", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	b := NewGitHubReleaseBackend(server.URL, server.URL, "pojntfx", "charts", "test-token")
+
+	url, err := b.Upload("test-app-0.0.1", testArchiveAsset)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if url != "https://example.com/test-app-linux-amd64" {
+		t.Error("download URL not returned correctly", url)
+	}
+
+	if uploaded != filepath.Base(testArchiveAsset)+":binary" {
+		t.Error("asset not uploaded correctly", uploaded)
+	}
+}
+
+func TestUploadErrorGitHubReleaseBackend(t *testing.T) {
+	setupArchiveTest(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	b := NewGitHubReleaseBackend(server.URL, server.URL, "pojntfx", "charts", "invalid-token")
+
+	if _, err := b.Upload("test-app-0.0.1", testArchiveAsset); err == nil {
+		t.Error("unauthorized upload did not return an error")
+	}
+}
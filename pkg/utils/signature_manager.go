@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// SignatureExtension is the extension of detached ed25519 signatures
+	SignatureExtension = ".sig"
+	// GPGSignatureExtension is the extension of detached, ASCII-armored GPG signatures
+	GPGSignatureExtension = ".asc"
+)
+
+// SignatureManager manages signatures of release artifacts
+type SignatureManager struct {
+	dir                    string
+	stdoutChan, stderrChan chan string
+}
+
+// NewSignatureManager creates a new SignatureManager
+func NewSignatureManager(dir string, stdoutChan, stderrChan chan string) *SignatureManager {
+	return &SignatureManager{
+		dir:        dir,
+		stdoutChan: stdoutChan,
+		stderrChan: stderrChan,
+	}
+}
+
+// GenerateSigningKeys generates a new base64-encoded ed25519 key pair
+func GenerateSigningKeys() (string, string, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(privateKey.Seed()), base64.StdEncoding.EncodeToString(publicKey), nil
+}
+
+func parsePrivateKey(privateKey string) (ed25519.PrivateKey, error) {
+	rawKey, err := base64.StdEncoding.DecodeString(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(rawKey) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(rawKey), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(rawKey), nil
+	default:
+		return nil, errors.New("invalid ed25519 private key length")
+	}
+}
+
+func parsePublicKey(publicKey string) (ed25519.PublicKey, error) {
+	rawKey, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rawKey) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid ed25519 public key length")
+	}
+
+	return ed25519.PublicKey(rawKey), nil
+}
+
+// GetSignableFiles returns the archives, checksums and provenance files in dist
+func GetSignableFiles(dist string) ([]string, error) {
+	var files []string
+	for _, pattern := range []string{"*." + ArchiveFormatTarGz, "*." + ArchiveFormatZip, ChecksumsFileName, "*" + ProvenanceExtension} {
+		matches, err := filepath.Glob(filepath.Join(dist, pattern))
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, matches...)
+	}
+
+	return files, nil
+}
+
+// GetSignableCharts returns the packaged Helm charts in dist
+func GetSignableCharts(dist string) ([]string, error) {
+	return filepath.Glob(filepath.Join(dist, "*.tgz"))
+}
+
+// GetSignatures returns the detached ed25519 and GPG signatures which exist next to files
+func GetSignatures(files []string) []string {
+	var signatures []string
+	for _, file := range files {
+		for _, extension := range []string{SignatureExtension, GPGSignatureExtension} {
+			if _, err := os.Stat(file + extension); err == nil {
+				signatures = append(signatures, file+extension)
+			}
+		}
+	}
+
+	return signatures
+}
+
+// Sign creates a detached ed25519 signature next to file and returns its path
+func (s *SignatureManager) Sign(privateKey, file string) (string, error) {
+	key, err := parsePrivateKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(key, content))
+	signaturePath := file + SignatureExtension
+
+	return signaturePath, ioutil.WriteFile(signaturePath, []byte(signature+"\n"), 0666)
+}
+
+// Verify checks the detached ed25519 signature next to file
+func (s *SignatureManager) Verify(publicKey, file string) error {
+	key, err := parsePublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	rawSignature, err := ioutil.ReadFile(file + SignatureExtension)
+	if err != nil {
+		return err
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(rawSignature)))
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(key, content, signature) {
+		return errors.New("invalid signature for " + file)
+	}
+
+	return nil
+}
+
+// SignGPG creates a detached, ASCII-armored GPG signature next to file using the `gpg` binary and returns its path
+func (s *SignatureManager) SignGPG(keyID, file string) (string, error) {
+	signaturePath := file + GPGSignatureExtension
+
+	command := NewManageableCommand("gpg --batch --yes --local-user "+quoteShellArg(keyID)+" --armor --output "+quoteShellArg(signaturePath)+" --detach-sign "+quoteShellArg(file), s.dir, s.stdoutChan, s.stderrChan)
+
+	if err := command.Start(); err != nil {
+		return "", err
+	}
+
+	return signaturePath, command.Wait()
+}
+
+// VerifyGPG checks the detached GPG signature next to file using the `gpg` binary
+func (s *SignatureManager) VerifyGPG(file string) error {
+	command := NewManageableCommand("gpg --batch --verify "+quoteShellArg(file+GPGSignatureExtension)+" "+quoteShellArg(file), s.dir, s.stdoutChan, s.stderrChan)
+
+	if err := command.Start(); err != nil {
+		return err
+	}
+
+	return command.Wait()
+}
@@ -0,0 +1,196 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var (
+	testSignatureFile = filepath.Join(testArchiveDir, "SHA256SUMS")
+)
+
+func TestCreateSignatureManager(t *testing.T) {
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+
+	s := NewSignatureManager(testContext, stdoutChan, stderrChan)
+
+	if s == nil {
+		t.Error("New signature manager is nil")
+	}
+
+	if s.dir != testContext {
+		t.Error("dir not set correctly")
+	}
+
+	if s.stdoutChan != stdoutChan {
+		t.Error("stdoutChan not set correctly")
+	}
+
+	if s.stderrChan != stderrChan {
+		t.Error("stderrChan not correctly")
+	}
+}
+
+func TestSignAndVerifySignatureManager(t *testing.T) {
+	setupArchiveTest(t)
+
+	if err := ioutil.WriteFile(testSignatureFile, []byte("checksums"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	privateKey, publicKey, err := GenerateSigningKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSignatureManager(testArchiveDir, make(chan string), make(chan string))
+
+	signature, err := s.Sign(privateKey, testSignatureFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if signature != testSignatureFile+SignatureExtension {
+		t.Error("signature not written next to file", signature)
+	}
+
+	if err := s.Verify(publicKey, testSignatureFile); err != nil {
+		t.Error(err)
+	}
+
+	if err := ioutil.WriteFile(testSignatureFile, []byte("tampered checksums"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Verify(publicKey, testSignatureFile); err == nil {
+		t.Error("tampered file passed verification")
+	}
+}
+
+func TestVerifyWrongKeySignatureManager(t *testing.T) {
+	setupArchiveTest(t)
+
+	if err := ioutil.WriteFile(testSignatureFile, []byte("checksums"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	privateKey, _, err := GenerateSigningKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, otherPublicKey, err := GenerateSigningKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSignatureManager(testArchiveDir, make(chan string), make(chan string))
+
+	if _, err := s.Sign(privateKey, testSignatureFile); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Verify(otherPublicKey, testSignatureFile); err == nil {
+		t.Error("signature passed verification with the wrong key")
+	}
+}
+
+func TestGetSignatures(t *testing.T) {
+	setupArchiveTest(t)
+
+	if err := ioutil.WriteFile(testSignatureFile, []byte("checksums"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if signatures := GetSignatures([]string{testSignatureFile}); len(signatures) != 0 {
+		t.Error("unsigned file has signatures", signatures)
+	}
+
+	if err := ioutil.WriteFile(testSignatureFile+GPGSignatureExtension, []byte("signature"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if signatures := GetSignatures([]string{testSignatureFile}); len(signatures) != 1 || signatures[0] != testSignatureFile+GPGSignatureExtension {
+		t.Error("signatures are", signatures, "expected the GPG signature")
+	}
+}
+
+func TestGetSignableCharts(t *testing.T) {
+	setupArchiveTest(t)
+
+	chart := filepath.Join(testArchiveDir, "test-app-0.0.1.tgz")
+	if err := ioutil.WriteFile(chart, []byte("chart"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	charts, err := GetSignableCharts(testArchiveDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(charts) != 1 || charts[0] != chart {
+		t.Error("charts are", charts, "expected", chart)
+	}
+}
+
+func TestGPGArgumentsSignatureManager(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dibs-gpg-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The fake gpg prints its arguments, so that they can be checked
+	if err := ioutil.WriteFile(filepath.Join(dir, "gpg"), []byte("#!/bin/sh\nfor arg in \"$@\"; do echo \"ARG $arg\"; done\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	stdoutChan, stderrChan := make(chan string), make(chan string)
+
+	var args []string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		for {
+			select {
+			case stdout, ok := <-stdoutChan:
+				if !ok {
+					return
+				}
+
+				args = append(args, stdout)
+			case stderr := <-stderrChan:
+				t.Error("error while running gpg", stderr)
+			}
+		}
+	}()
+
+	s := NewSignatureManager(dir, stdoutChan, stderrChan)
+	file := filepath.Join(dir, "app v1.0.0; touch pwned.tar.gz")
+
+	if _, err := s.SignGPG("Jane Doe <jane@example.com>", file); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.VerifyGPG(file); err != nil {
+		t.Fatal(err)
+	}
+
+	close(stdoutChan)
+	<-done
+
+	for _, expected := range []string{"ARG Jane Doe <jane@example.com>\nARG --armor", "ARG " + file + GPGSignatureExtension + "\nARG --detach-sign\nARG " + file, "ARG --verify\nARG " + file + GPGSignatureExtension + "\nARG " + file} {
+		if !strings.Contains(strings.Join(args, "\n"), expected) {
+			t.Errorf("arguments of gpg are %q, expected them to contain %q", args, expected)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "pwned.tar.gz")); err == nil {
+		t.Error("file name has been run by the shell")
+	}
+}